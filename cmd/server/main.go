@@ -1,22 +1,40 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"opus-api/internal/handler"
 	"opus-api/internal/logger"
 	"opus-api/internal/middleware"
 	"opus-api/internal/model"
+	"opus-api/internal/secret"
 	"opus-api/internal/service"
 	"opus-api/internal/tokenizer"
 	"opus-api/internal/types"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+// defaultModelsConfig 默认的模型配置文件路径
+const defaultModelsConfig = "./config/models.json"
+
+// shutdownTimeout 关闭时等待进行中请求完成的最长时间
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	// Stop gracefully on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Printf("[INFO] No .env file found or error loading it: %v", err)
@@ -34,11 +52,26 @@ func main() {
 		logger.CleanupOldLogs()
 	}
 
+	// Load upstream retry settings
+	loadUpstreamConfig()
+
+	// Load tool call validation policy
+	loadToolConfig()
+
+	// Load image and document handling
+	loadImageConfig()
+
+	// Load model registry
+	loadModelRegistry()
+
 	// Initialize tokenizer for token counting
 	if err := tokenizer.Init(); err != nil {
 		log.Printf("[WARN] Failed to initialize tokenizer: %v (will use fallback)", err)
 	}
 
+	// Load the master key used to encrypt cookie secrets at rest
+	loadEncryptionKey()
+
 	// Initialize database
 	if err := model.InitDB(); err != nil {
 		log.Printf("[WARN] Failed to initialize database: %v (running without database)", err)
@@ -47,6 +80,21 @@ func main() {
 		if err := model.CreateDefaultAdmin(model.DB); err != nil {
 			log.Printf("[WARN] Failed to create default admin: %v", err)
 		}
+
+		// Keep cookies created before pools existed shared, new ones are private
+		if err := model.MigrateLegacySharedPool(model.DB); err != nil {
+			log.Printf("[WARN] Failed to migrate legacy shared cookies: %v", err)
+		}
+
+		// Encrypt plaintext secrets and re-encrypt those under a previous key
+		if err := model.EncryptCookieSecrets(model.DB); err != nil {
+			log.Printf("[WARN] Failed to encrypt cookie secrets: %v", err)
+		}
+
+		// Hash cookies created before import deduplication existed
+		if err := model.BackfillCookieKeyHashes(model.DB); err != nil {
+			log.Printf("[WARN] Failed to backfill cookie key hashes: %v", err)
+		}
 	}
 
 	// Initialize services
@@ -54,12 +102,19 @@ func main() {
 	var cookieService *service.CookieService
 	var cookieValidator *service.CookieValidator
 	var cookieRotator *service.CookieRotator
+	var apiKeyService *service.APIKeyService
+	var healthChecker *service.HealthChecker
+	var jobManager *service.JobManager
 
 	if model.DB != nil {
 		authService = service.NewAuthService(model.DB)
 		cookieService = service.NewCookieService(model.DB)
 		cookieValidator = service.NewCookieValidator(cookieService)
 		cookieRotator = service.NewCookieRotator(cookieService, service.StrategyRoundRobin)
+		cookieRotator.LoadStrategy()
+		apiKeyService = service.NewAPIKeyService(model.DB)
+		healthChecker = service.NewHealthChecker(cookieValidator)
+		jobManager = service.NewJobManager(cookieValidator)
 
 		// Store rotator in types for use in messages handler
 		types.CookieRotatorInstance = cookieRotator
@@ -85,7 +140,20 @@ func main() {
 	})
 
 	// Register API routes
-	router.POST("/v1/messages", handler.HandleMessages)
+	// Without a database there are no API keys to check against
+	v1Group := router.Group("/v1")
+	if apiKeyService != nil {
+		v1Group.Use(middleware.APIKeyMiddleware(apiKeyService))
+	} else {
+		log.Printf("[WARN] Database unavailable, /v1 endpoints are not authenticated")
+	}
+	{
+		v1Group.POST("/messages", handler.HandleMessages)
+		v1Group.POST("/messages/count_tokens", handler.HandleCountTokens)
+		v1Group.POST("/chat/completions", handler.HandleChatCompletions)
+		v1Group.GET("/models", handler.HandleListModels)
+		v1Group.GET("/models/:id", handler.HandleGetModel)
+	}
 	router.GET("/health", handler.HandleHealth)
 
 	// Auth routes (only if database is available)
@@ -97,21 +165,48 @@ func main() {
 		// Protected routes
 		authGroup := router.Group("/api")
 		authGroup.Use(middleware.AuthMiddleware(authService))
+		adminOnly := middleware.AdminMiddleware(authService)
 		{
 			authGroup.GET("/auth/me", authHandler.Me)
 			authGroup.PUT("/auth/password", authHandler.ChangePassword)
 
 			// Cookie management routes
 			if cookieService != nil && cookieValidator != nil {
-				cookieHandler := handler.NewCookieHandler(cookieService, cookieValidator)
+				cookieHandler := handler.NewCookieHandler(cookieService, cookieValidator, cookieRotator.Limiter())
 				authGroup.GET("/cookies", cookieHandler.ListCookies)
 				authGroup.GET("/cookies/stats", cookieHandler.GetStats)
+				authGroup.GET("/cookies/export", cookieHandler.ExportCookies)
+				authGroup.POST("/cookies/import", cookieHandler.ImportCookies)
 				authGroup.POST("/cookies", cookieHandler.CreateCookie)
 				authGroup.GET("/cookies/:id", cookieHandler.GetCookie)
 				authGroup.PUT("/cookies/:id", cookieHandler.UpdateCookie)
 				authGroup.DELETE("/cookies/:id", cookieHandler.DeleteCookie)
 				authGroup.POST("/cookies/:id/validate", cookieHandler.ValidateCookie)
-				authGroup.POST("/cookies/validate/all", cookieHandler.ValidateAllCookies)
+				authGroup.GET("/cookies/:id/validations", cookieHandler.ListValidations)
+				authGroup.GET("/pools", cookieHandler.ListPools)
+				authGroup.PUT("/pools/:name", adminOnly, cookieHandler.UpdatePool)
+			}
+
+			// Bulk validation jobs
+			if jobManager != nil {
+				jobHandler := handler.NewJobHandler(jobManager)
+				authGroup.POST("/cookies/validate/all", jobHandler.ValidateAllCookies)
+				authGroup.GET("/jobs/:id/events", jobHandler.Events)
+			}
+
+			// Rotation strategy routes
+			if cookieRotator != nil {
+				rotationHandler := handler.NewRotationHandler(cookieRotator)
+				authGroup.GET("/rotation/strategy", rotationHandler.GetStrategy)
+				authGroup.PUT("/rotation/strategy", adminOnly, rotationHandler.UpdateStrategy)
+			}
+
+			// API key management routes
+			if apiKeyService != nil {
+				apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService, authService)
+				authGroup.GET("/keys", apiKeyHandler.ListKeys)
+				authGroup.POST("/keys", apiKeyHandler.CreateKey)
+				authGroup.DELETE("/keys/:id", apiKeyHandler.RevokeKey)
 			}
 		}
 	}
@@ -128,7 +223,118 @@ func main() {
 	log.Printf("Log directory: %s", types.LogDir)
 	log.Printf("Database connected: %v", model.DB != nil)
 
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Start background cookie health checks
+	if healthChecker != nil {
+		healthChecker.Start(ctx)
+	}
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Printf("[INFO] Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[WARN] Server shutdown: %v", err)
+	}
+
+	if healthChecker != nil {
+		healthChecker.Wait()
+	}
+	if jobManager != nil {
+		jobManager.Stop()
+	}
+	if model.DB != nil {
+		if err := model.CloseDB(); err != nil {
+			log.Printf("[WARN] Failed to close database: %v", err)
+		}
+	}
+	log.Printf("[INFO] Server stopped")
+}
+
+// loadUpstreamConfig 从环境变量读取上游重试配置
+func loadUpstreamConfig() {
+	if value := os.Getenv("UPSTREAM_MAX_ATTEMPTS"); value != "" {
+		if attempts, err := strconv.Atoi(value); err == nil && attempts > 0 {
+			types.UpstreamMaxAttempts = attempts
+		} else {
+			log.Printf("[WARN] Invalid UPSTREAM_MAX_ATTEMPTS %q, using %d", value, types.UpstreamMaxAttempts)
+		}
+	}
+	if value := os.Getenv("UPSTREAM_RETRY_DEADLINE"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			types.UpstreamRetryDeadline = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("[WARN] Invalid UPSTREAM_RETRY_DEADLINE %q, using %v", value, types.UpstreamRetryDeadline)
+		}
+	}
+}
+
+// loadToolConfig 从环境变量读取工具调用校验策略
+func loadToolConfig() {
+	value := os.Getenv("TOOL_VALIDATION_POLICY")
+	switch policy := types.ToolValidationPolicy(value); policy {
+	case "":
+	case types.ToolPolicyPass, types.ToolPolicyDrop, types.ToolPolicyText:
+		types.ToolPolicy = policy
+	default:
+		log.Printf("[WARN] Invalid TOOL_VALIDATION_POLICY %q, using %s", value, types.ToolPolicy)
+	}
+}
+
+// loadImageConfig 从环境变量读取图片和文档的处理方式
+func loadImageConfig() {
+	value := os.Getenv("IMAGE_MODE")
+	switch mode := types.ImageMode(value); mode {
+	case "":
+	case types.ImageModeForward, types.ImageModePlaceholder, types.ImageModeReject:
+		types.ImageHandling = mode
+	default:
+		log.Printf("[WARN] Invalid IMAGE_MODE %q, using %s", value, types.ImageHandling)
+	}
+}
+
+// loadEncryptionKey 加载 Cookie 密钥的加密主密钥，配置错误时退出，避免以错误的密钥写入数据
+func loadEncryptionKey() {
+	keyring, err := secret.LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+	if keyring == nil {
+		log.Printf("[WARN] ENCRYPTION_KEY not set, cookie secrets are stored in plaintext")
+		return
+	}
+	model.SetKeyring(keyring)
+	log.Printf("[INFO] Cookie secrets are encrypted at rest")
+}
+
+// loadModelRegistry 从 MODELS_CONFIG 指定的文件加载模型注册表
+// 未设置时尝试 ./config/models.json，文件不存在则使用内置配置
+func loadModelRegistry() {
+	path := os.Getenv("MODELS_CONFIG")
+	if path == "" {
+		path = defaultModelsConfig
+		if _, err := os.Stat(path); err != nil {
+			log.Printf("[INFO] No model config found, using built-in models")
+			return
+		}
+	}
+
+	registry, err := types.LoadModelRegistry(path)
+	if err != nil {
+		log.Printf("[WARN] Failed to load model config %s: %v (using built-in models)", path, err)
+		return
 	}
+	types.Models = registry
+	log.Printf("[INFO] Loaded %d model(s) from %s", len(registry.IDs()), path)
 }
@@ -0,0 +1,137 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error types defined by the Anthropic API
+const (
+	TypeInvalidRequest  = "invalid_request_error"
+	TypeAuthentication  = "authentication_error"
+	TypePermission      = "permission_error"
+	TypeNotFound        = "not_found_error"
+	TypeRequestTooLarge = "request_too_large"
+	TypeRateLimit       = "rate_limit_error"
+	TypeAPI             = "api_error"
+	TypeOverloaded      = "overloaded_error"
+)
+
+// StatusOverloaded is the non-standard status Anthropic uses for overloaded_error
+const StatusOverloaded = 529
+
+// Error is an API error with its HTTP status and Anthropic error type
+type Error struct {
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Type, e.Status, e.Message)
+}
+
+// Response is the JSON body of an error response
+type Response struct {
+	Type  string `json:"type"` // "error"
+	Error Detail `json:"error"`
+}
+
+// Detail is the error object inside Response
+type Detail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// New creates an error
+func New(status int, errType, message string) *Error {
+	return &Error{Status: status, Type: errType, Message: message}
+}
+
+// InvalidRequest 400 invalid_request_error
+func InvalidRequest(message string) *Error {
+	return New(http.StatusBadRequest, TypeInvalidRequest, message)
+}
+
+// Authentication 401 authentication_error
+func Authentication(message string) *Error {
+	return New(http.StatusUnauthorized, TypeAuthentication, message)
+}
+
+// Permission 403 permission_error
+func Permission(message string) *Error {
+	return New(http.StatusForbidden, TypePermission, message)
+}
+
+// NotFound 404 not_found_error
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, TypeNotFound, message)
+}
+
+// RateLimit 429 rate_limit_error
+func RateLimit(message string) *Error {
+	return New(http.StatusTooManyRequests, TypeRateLimit, message)
+}
+
+// Internal 500 api_error
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, TypeAPI, message)
+}
+
+// Overloaded 529 overloaded_error
+func Overloaded(message string) *Error {
+	return New(StatusOverloaded, TypeOverloaded, message)
+}
+
+// Body returns the JSON body for the error
+func (e *Error) Body() Response {
+	return Response{
+		Type:  "error",
+		Error: Detail{Type: e.Type, Message: e.Message},
+	}
+}
+
+// SSEFrame formats the error as an `event: error` SSE frame, used when a
+// stream fails after the response headers were sent
+func (e *Error) SSEFrame() string {
+	data, _ := json.Marshal(e.Body())
+	return fmt.Sprintf("event: error\ndata: %s\n\n", string(data))
+}
+
+// Write writes the error response
+func Write(c *gin.Context, err *Error) {
+	c.JSON(err.Status, err.Body())
+}
+
+// Abort writes the error response and stops the middleware chain
+func Abort(c *gin.Context, err *Error) {
+	c.AbortWithStatusJSON(err.Status, err.Body())
+}
+
+// FromUpstreamStatus maps a MorphLLM response status to the error returned
+// to the client, so that SDKs retry exactly when a retry can help.
+// status 0 means the upstream could not be reached.
+func FromUpstreamStatus(status int, message string) *Error {
+	switch {
+	case status == 0:
+		return New(http.StatusBadGateway, TypeAPI, message)
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return InvalidRequest(message)
+	case status == http.StatusRequestEntityTooLarge:
+		return New(http.StatusRequestEntityTooLarge, TypeRequestTooLarge, message)
+	case status == http.StatusTooManyRequests:
+		return RateLimit(message)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		// 上游拒绝的是网关自己的 Cookie，而不是客户端的凭证
+		return New(http.StatusBadGateway, TypeAPI, message)
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return New(http.StatusGatewayTimeout, TypeAPI, message)
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == StatusOverloaded:
+		return Overloaded(message)
+	default:
+		return New(http.StatusBadGateway, TypeAPI, message)
+	}
+}
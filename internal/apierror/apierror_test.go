@@ -0,0 +1,47 @@
+package apierror
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFromUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		upstream   int
+		wantStatus int
+		wantType   string
+	}{
+		{0, 502, TypeAPI},
+		{400, 400, TypeInvalidRequest},
+		{413, 413, TypeRequestTooLarge},
+		{429, 429, TypeRateLimit},
+		{401, 502, TypeAPI},
+		{504, 504, TypeAPI},
+		{503, StatusOverloaded, TypeOverloaded},
+		{500, 502, TypeAPI},
+	}
+
+	for _, tt := range tests {
+		err := FromUpstreamStatus(tt.upstream, "msg")
+		if err.Status != tt.wantStatus || err.Type != tt.wantType {
+			t.Errorf("FromUpstreamStatus(%d) = %d %s, want %d %s", tt.upstream, err.Status, err.Type, tt.wantStatus, tt.wantType)
+		}
+	}
+}
+
+func TestSSEFrame(t *testing.T) {
+	frame := Overloaded("busy").SSEFrame()
+	if !strings.HasPrefix(frame, "event: error\ndata: ") || !strings.HasSuffix(frame, "\n\n") {
+		t.Fatalf("unexpected frame: %q", frame)
+	}
+
+	var body Response
+	data := strings.TrimSuffix(strings.TrimPrefix(frame, "event: error\ndata: "), "\n\n")
+	if err := json.Unmarshal([]byte(data), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body.Type != "error" || body.Error.Type != TypeOverloaded || body.Error.Message != "busy" {
+		t.Errorf("unexpected body: %+v", body)
+	}
+}
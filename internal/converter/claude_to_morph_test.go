@@ -0,0 +1,42 @@
+package converter
+
+import (
+	"opus-api/internal/types"
+	"strings"
+	"testing"
+)
+
+func TestClaudeToMorph_ToolChoice(t *testing.T) {
+	cases := []struct {
+		toolChoice   interface{}
+		instructions bool
+		forcing      string
+	}{
+		{nil, true, ""},
+		{map[string]interface{}{"type": "auto"}, true, ""},
+		{map[string]interface{}{"type": "none"}, false, ""},
+		{map[string]interface{}{"type": "any"}, true, "MUST call at least one of the tools"},
+		{map[string]interface{}{"type": "tool", "name": "Bash"}, true, "MUST call the tool Bash"},
+		{map[string]interface{}{"type": "auto", "disable_parallel_tool_use": true}, true, "at most one tool"},
+	}
+
+	for _, c := range cases {
+		morphReq := ClaudeToMorph(types.ClaudeRequest{
+			Model:      "claude-opus-4-5",
+			Messages:   []types.ClaudeMessage{{Role: "user", Content: "List files"}},
+			Tools:      []types.ClaudeTool{{Name: "Bash", InputSchema: map[string]interface{}{"type": "object"}}},
+			ToolChoice: c.toolChoice,
+		})
+		text := morphReq.Messages[0].Parts[0].Text
+
+		if strings.Contains(text, "<function_calls>") != c.instructions {
+			t.Errorf("%v: expected tool instructions %v", c.toolChoice, c.instructions)
+		}
+		if c.forcing != "" && !strings.Contains(text, c.forcing) {
+			t.Errorf("%v: expected %q in the instructions", c.toolChoice, c.forcing)
+		}
+		if c.forcing == "" && strings.Contains(text, "MUST call") {
+			t.Errorf("%v: unexpected forcing instructions", c.toolChoice)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package converter
 import (
 	"encoding/json"
 	"fmt"
+	"mime"
+	"net/url"
 	"opus-api/internal/types"
+	"path"
 	"strings"
 )
 
@@ -44,6 +47,10 @@ func ExtractTextFromContent(content interface{}) string {
 				}
 				xml := fmt.Sprintf("<function_results>\n<result>\n<tool_use_id>%s</tool_use_id>\n<output>%s</output>\n</result>\n</function_results>", b.ToolUseID, resultContent)
 				textParts = append(textParts, xml)
+			case types.ClaudeContentBlockImage, types.ClaudeContentBlockDocument:
+				if text := mediaText(b); text != "" {
+					textParts = append(textParts, text)
+				}
 			}
 		}
 		return strings.Join(textParts, "\n")
@@ -65,5 +72,126 @@ func ExtractSystemText(system interface{}) string {
 		}
 		return strings.Join(texts, "\n")
 	}
+	// JSON 解码后的 system 数组为 []interface{}
+	if items, ok := system.([]interface{}); ok {
+		var texts []string
+		for _, item := range items {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				if text, ok := itemMap["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
 	return ""
 }
+
+// mediaText returns the text standing in for an image or document block.
+// Text documents are inlined; other media is sent as file parts in forward
+// mode and replaced by a placeholder otherwise.
+func mediaText(block types.ClaudeContentBlock) string {
+	if doc, ok := block.(types.ClaudeContentBlockDocument); ok && doc.Source.Type == "text" {
+		if doc.Title != "" {
+			return fmt.Sprintf("<document title=%q>\n%s\n</document>", doc.Title, doc.Source.Data)
+		}
+		return "<document>\n" + doc.Source.Data + "\n</document>"
+	}
+	if types.ImageHandling == types.ImageModeForward {
+		return ""
+	}
+
+	kind, title, source := mediaBlockInfo(block)
+	var details []string
+	if title != "" {
+		details = append(details, title)
+	}
+	if source.Type == "url" {
+		details = append(details, source.URL)
+	} else if source.MediaType != "" {
+		details = append(details, source.MediaType)
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("[%s omitted]", kind)
+	}
+	return fmt.Sprintf("[%s omitted: %s]", kind, strings.Join(details, ", "))
+}
+
+// mediaBlockInfo returns the kind, title and source of an image or document block
+func mediaBlockInfo(block types.ClaudeContentBlock) (string, string, types.ClaudeMediaSource) {
+	switch b := block.(type) {
+	case types.ClaudeContentBlockImage:
+		return "image", "", b.Source
+	case types.ClaudeContentBlockDocument:
+		return "document", b.Title, b.Source
+	}
+	return "", "", types.ClaudeMediaSource{}
+}
+
+// MediaBlocks returns the image and document blocks of message content that
+// cannot be sent as text, including those inside tool results
+func MediaBlocks(content interface{}) []types.ClaudeContentBlock {
+	blocks, _ := content.([]types.ClaudeContentBlock)
+	var media []types.ClaudeContentBlock
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case types.ClaudeContentBlockImage:
+			media = append(media, b)
+		case types.ClaudeContentBlockDocument:
+			if b.Source.Type != "text" {
+				media = append(media, b)
+			}
+		case types.ClaudeContentBlockToolResult:
+			media = append(media, MediaBlocks(b.Content)...)
+		}
+	}
+	return media
+}
+
+// MediaParts converts the image and document blocks of message content to
+// Morph file parts. base64 sources are sent as data URLs.
+func MediaParts(content interface{}) []types.MorphPart {
+	var parts []types.MorphPart
+	for _, block := range MediaBlocks(content) {
+		kind, title, source := mediaBlockInfo(block)
+		part := types.MorphPart{Type: "file", MediaType: source.MediaType, Filename: title}
+		if source.Type == "url" {
+			part.URL = source.URL
+			if part.MediaType == "" {
+				part.MediaType = mediaTypeFromURL(kind, source.URL)
+			}
+		} else {
+			part.URL = "data:" + source.MediaType + ";base64," + source.Data
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// mediaTypeFromURL guesses the media type of a URL source from its file
+// extension. Documents default to PDF, the only URL document type.
+func mediaTypeFromURL(kind, rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if mediaType := mime.TypeByExtension(path.Ext(u.Path)); mediaType != "" {
+			return strings.SplitN(mediaType, ";", 2)[0]
+		}
+	}
+	if kind == "document" {
+		return "application/pdf"
+	}
+	return "image/*"
+}
+
+// CheckMedia returns an error naming the first message with an image or
+// document block when IMAGE_MODE is reject
+func CheckMedia(req types.ClaudeRequest) error {
+	if types.ImageHandling != types.ImageModeReject {
+		return nil
+	}
+	for i, msg := range req.Messages {
+		if media := MediaBlocks(msg.Content); len(media) > 0 {
+			return fmt.Errorf("messages.%d: %s content is not supported", i, media[0].GetType())
+		}
+	}
+	return nil
+}
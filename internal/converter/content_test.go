@@ -0,0 +1,109 @@
+package converter
+
+import (
+	"encoding/json"
+	"opus-api/internal/types"
+	"strings"
+	"testing"
+)
+
+// mediaRequest has a base64 image, a URL image, a PDF and a text document,
+// and a screenshot returned by a tool
+const mediaRequest = `{
+	"model": "claude-opus-4-5",
+	"messages": [
+		{"role": "user", "content": [
+			{"type": "text", "text": "What is wrong here?"},
+			{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}},
+			{"type": "image", "source": {"type": "url", "url": "https://example.com/shot.jpg"}},
+			{"type": "document", "title": "spec.pdf", "source": {"type": "base64", "media_type": "application/pdf", "data": "JVBERi0="}},
+			{"type": "document", "title": "notes", "source": {"type": "text", "media_type": "text/plain", "data": "Use tabs."}}
+		]},
+		{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "Screenshot", "input": {}}]},
+		{"role": "user", "content": [
+			{"type": "tool_result", "tool_use_id": "toolu_1", "content": [
+				{"type": "text", "text": "Captured."},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/webp", "data": "UklGRg=="}}
+			]}
+		]}
+	]
+}`
+
+// convertWithImageMode converts mediaRequest with the given IMAGE_MODE
+func convertWithImageMode(t *testing.T, mode types.ImageMode) (types.ClaudeRequest, types.MorphRequest) {
+	previous := types.ImageHandling
+	types.ImageHandling = mode
+	t.Cleanup(func() { types.ImageHandling = previous })
+
+	var claudeReq types.ClaudeRequest
+	if err := json.Unmarshal([]byte(mediaRequest), &claudeReq); err != nil {
+		t.Fatalf("Invalid request: %v", err)
+	}
+	return claudeReq, ClaudeToMorph(claudeReq)
+}
+
+func TestClaudeToMorph_MediaPlaceholder(t *testing.T) {
+	claudeReq, morphReq := convertWithImageMode(t, types.ImageModePlaceholder)
+	if err := CheckMedia(claudeReq); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	first := morphReq.Messages[0]
+	if len(first.Parts) != 1 {
+		t.Fatalf("Expected a single text part, got %+v", first.Parts)
+	}
+	for _, expected := range []string{
+		"[image omitted: image/png]",
+		"[image omitted: https://example.com/shot.jpg]",
+		"[document omitted: spec.pdf, application/pdf]",
+		"<document title=\"notes\">\nUse tabs.\n</document>",
+	} {
+		if !strings.Contains(first.Parts[0].Text, expected) {
+			t.Errorf("Expected %q in %q", expected, first.Parts[0].Text)
+		}
+	}
+
+	result := morphReq.Messages[2].Parts[0].Text
+	if !strings.Contains(result, "Captured.\n[image omitted: image/webp]") {
+		t.Errorf("Expected the tool result text and image placeholder, got %q", result)
+	}
+}
+
+func TestClaudeToMorph_MediaForward(t *testing.T) {
+	_, morphReq := convertWithImageMode(t, types.ImageModeForward)
+
+	first := morphReq.Messages[0]
+	if strings.Contains(first.Parts[0].Text, "omitted") || !strings.Contains(first.Parts[0].Text, "Use tabs.") {
+		t.Errorf("Unexpected text %q", first.Parts[0].Text)
+	}
+	expected := []types.MorphPart{
+		{Type: "file", MediaType: "image/png", URL: "data:image/png;base64,iVBORw0KGgo="},
+		{Type: "file", MediaType: "image/jpeg", URL: "https://example.com/shot.jpg"},
+		{Type: "file", MediaType: "application/pdf", URL: "data:application/pdf;base64,JVBERi0=", Filename: "spec.pdf"},
+	}
+	if len(first.Parts) != len(expected)+1 {
+		t.Fatalf("Expected text and %d file parts, got %+v", len(expected), first.Parts)
+	}
+	for i, part := range expected {
+		if first.Parts[i+1] != part {
+			t.Errorf("Expected %+v, got %+v", part, first.Parts[i+1])
+		}
+	}
+
+	if parts := morphReq.Messages[2].Parts; len(parts) != 2 || parts[1].MediaType != "image/webp" {
+		t.Errorf("Expected the tool result image as a file part, got %+v", parts)
+	}
+}
+
+func TestCheckMedia_Reject(t *testing.T) {
+	claudeReq, _ := convertWithImageMode(t, types.ImageModeReject)
+	err := CheckMedia(claudeReq)
+	if err == nil || !strings.Contains(err.Error(), "messages.0: image") {
+		t.Errorf("Expected the image to be rejected, got %v", err)
+	}
+
+	claudeReq.Messages = claudeReq.Messages[1:]
+	if err := CheckMedia(claudeReq); err == nil || !strings.Contains(err.Error(), "messages.1: image") {
+		t.Errorf("Expected the tool result image to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"opus-api/internal/types"
+	"strings"
+)
+
+// OpenAIToClaude converts an OpenAI Chat Completions request to a Claude request
+func OpenAIToClaude(req types.OpenAIChatRequest) (types.ClaudeRequest, error) {
+	claudeReq := types.ClaudeRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Stream:      req.Stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Metadata:    req.Metadata,
+	}
+	if req.MaxCompletionTokens > 0 {
+		claudeReq.MaxTokens = req.MaxCompletionTokens
+	}
+	if req.User != "" {
+		if claudeReq.Metadata == nil {
+			claudeReq.Metadata = map[string]interface{}{}
+		}
+		claudeReq.Metadata["user_id"] = req.User
+	}
+
+	var systemTexts []string
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			systemTexts = append(systemTexts, openAIContentText(msg.Content))
+
+		case "user":
+			content, err := openAIUserContent(msg.Content)
+			if err != nil {
+				return claudeReq, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			claudeReq.Messages = append(claudeReq.Messages, types.ClaudeMessage{
+				Role:    "user",
+				Content: content,
+			})
+
+		case "assistant":
+			var blocks []types.ClaudeContentBlock
+			if text := openAIContentText(msg.Content); text != "" {
+				blocks = append(blocks, types.ClaudeContentBlockText{Type: "text", Text: text})
+			}
+			for _, toolCall := range msg.ToolCalls {
+				input := map[string]interface{}{}
+				if toolCall.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &input); err != nil {
+						return claudeReq, fmt.Errorf("messages[%d]: invalid arguments for tool call %s: %w", i, toolCall.ID, err)
+					}
+				}
+				blocks = append(blocks, types.ClaudeContentBlockToolUse{
+					Type:  "tool_use",
+					ID:    toolCall.ID,
+					Name:  toolCall.Function.Name,
+					Input: input,
+				})
+			}
+			claudeReq.Messages = append(claudeReq.Messages, types.ClaudeMessage{
+				Role:    "assistant",
+				Content: blocks,
+			})
+
+		case "tool":
+			result := types.ClaudeContentBlockToolResult{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   openAIContentText(msg.Content),
+			}
+			// Consecutive tool messages answer the same assistant turn
+			if last := len(claudeReq.Messages) - 1; last >= 0 && isToolResultMessage(claudeReq.Messages[last]) {
+				blocks := claudeReq.Messages[last].Content.([]types.ClaudeContentBlock)
+				claudeReq.Messages[last].Content = append(blocks, result)
+			} else {
+				claudeReq.Messages = append(claudeReq.Messages, types.ClaudeMessage{
+					Role:    "user",
+					Content: []types.ClaudeContentBlock{result},
+				})
+			}
+
+		default:
+			return claudeReq, fmt.Errorf("messages[%d]: unsupported role '%s'", i, msg.Role)
+		}
+	}
+	if len(systemTexts) > 0 {
+		claudeReq.System = strings.Join(systemTexts, "\n\n")
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		claudeReq.Tools = append(claudeReq.Tools, types.ClaudeTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	claudeReq.ToolChoice = openAIToolChoiceToClaude(req.ToolChoice, req.ParallelToolCalls)
+
+	return claudeReq, nil
+}
+
+// openAIToolChoiceToClaude maps tool_choice and parallel_tool_calls to the Claude format
+func openAIToolChoiceToClaude(toolChoice interface{}, parallelToolCalls *bool) interface{} {
+	var choice map[string]interface{}
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "none":
+			choice = map[string]interface{}{"type": "none"}
+		case "required":
+			choice = map[string]interface{}{"type": "any"}
+		case "auto":
+			choice = map[string]interface{}{"type": "auto"}
+		}
+	case map[string]interface{}:
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				choice = map[string]interface{}{"type": "tool", "name": name}
+			}
+		}
+	}
+
+	if parallelToolCalls != nil && !*parallelToolCalls {
+		if choice == nil {
+			choice = map[string]interface{}{"type": "auto"}
+		}
+		choice["disable_parallel_tool_use"] = true
+	}
+
+	if choice == nil {
+		return nil
+	}
+	return choice
+}
+
+// openAIContentText extracts the text of an OpenAI message content
+// (a string or an array of content parts)
+func openAIContentText(content interface{}) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var texts []string
+		for _, part := range v {
+			partMap, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if text, ok := partMap["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// openAIUserContent converts the content of an OpenAI user message. Text
+// only content becomes a string; content with image_url parts becomes text
+// and image blocks in their original order.
+func openAIUserContent(content interface{}) (interface{}, error) {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return openAIContentText(content), nil
+	}
+
+	var blocks []types.ClaudeContentBlock
+	hasImage := false
+	for _, part := range parts {
+		partMap, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch partMap["type"] {
+		case "image_url":
+			// image_url is an object with a url, some clients send the url itself
+			imageURL, _ := partMap["image_url"].(string)
+			if imageObj, ok := partMap["image_url"].(map[string]interface{}); ok {
+				imageURL, _ = imageObj["url"].(string)
+			}
+			source, err := imageURLSource(imageURL)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, types.ClaudeContentBlockImage{Type: "image", Source: source})
+			hasImage = true
+		default:
+			if text, ok := partMap["text"].(string); ok {
+				blocks = append(blocks, types.ClaudeContentBlockText{Type: "text", Text: text})
+			}
+		}
+	}
+	if !hasImage {
+		return openAIContentText(content), nil
+	}
+	return blocks, nil
+}
+
+// imageURLSource converts the url of an image_url part to a Claude image
+// source: base64 data URLs become base64 sources and http(s) URLs url sources
+func imageURLSource(rawURL string) (types.ClaudeMediaSource, error) {
+	if strings.HasPrefix(rawURL, "data:") {
+		meta, data, ok := strings.Cut(strings.TrimPrefix(rawURL, "data:"), ",")
+		mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+		if !ok || !isBase64 || mediaType == "" {
+			return types.ClaudeMediaSource{}, fmt.Errorf("image_url data URLs must be base64 encoded with a media type")
+		}
+		return types.ClaudeMediaSource{Type: "base64", MediaType: mediaType, Data: data}, nil
+	}
+	if u, err := url.Parse(rawURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return types.ClaudeMediaSource{Type: "url", URL: rawURL}, nil
+	}
+	return types.ClaudeMediaSource{}, fmt.Errorf("image_url must be an http(s) or data URL")
+}
+
+// isToolResultMessage reports whether a message only carries tool results
+func isToolResultMessage(msg types.ClaudeMessage) bool {
+	blocks, ok := msg.Content.([]types.ClaudeContentBlock)
+	if !ok || msg.Role != "user" || len(blocks) == 0 {
+		return false
+	}
+	for _, block := range blocks {
+		if _, ok := block.(types.ClaudeContentBlockToolResult); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"opus-api/internal/types"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIToClaude_ToolRoundTrip(t *testing.T) {
+	req := types.OpenAIChatRequest{
+		Model: "claude-opus-4-5",
+		Messages: []types.OpenAIMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "List files"},
+			{Role: "assistant", ToolCalls: []types.OpenAIToolCall{
+				{ID: "call_1", Type: "function", Function: types.OpenAIFunctionCall{Name: "Bash", Arguments: `{"command":"ls"}`}},
+				{ID: "call_2", Type: "function", Function: types.OpenAIFunctionCall{Name: "Bash", Arguments: `{"command":"pwd"}`}},
+			}},
+			{Role: "tool", ToolCallID: "call_1", Content: "a.go"},
+			{Role: "tool", ToolCallID: "call_2", Content: "/root"},
+		},
+		Tools: []types.OpenAITool{
+			{Type: "function", Function: types.OpenAIFunction{Name: "Bash", Parameters: map[string]interface{}{"type": "object"}}},
+		},
+		ToolChoice: "required",
+	}
+
+	claudeReq, err := OpenAIToClaude(req)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+
+	if claudeReq.System != "Be brief." {
+		t.Errorf("Unexpected system prompt %v", claudeReq.System)
+	}
+	if len(claudeReq.Messages) != 3 {
+		t.Fatalf("Expected 3 messages (tool results merged), got %d", len(claudeReq.Messages))
+	}
+
+	assistant := claudeReq.Messages[1].Content.([]types.ClaudeContentBlock)
+	toolUse, ok := assistant[0].(types.ClaudeContentBlockToolUse)
+	if !ok || toolUse.Input["command"] != "ls" {
+		t.Errorf("Unexpected tool_use block %+v", assistant[0])
+	}
+
+	results := claudeReq.Messages[2].Content.([]types.ClaudeContentBlock)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 tool results in one message, got %d", len(results))
+	}
+
+	choice, _ := claudeReq.ToolChoice.(map[string]interface{})
+	if choice["type"] != "any" {
+		t.Errorf("Expected tool_choice any, got %v", claudeReq.ToolChoice)
+	}
+	if len(claudeReq.Tools) != 1 || claudeReq.Tools[0].Name != "Bash" {
+		t.Errorf("Unexpected tools %+v", claudeReq.Tools)
+	}
+}
+
+func TestOpenAIToClaude_ImageURL(t *testing.T) {
+	req := types.OpenAIChatRequest{
+		Model: "claude-opus-4-5",
+		Messages: []types.OpenAIMessage{
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "Compare these"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,iVBORw0KGgo="}},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/cat.jpg", "detail": "low"}},
+			}},
+		},
+	}
+
+	claudeReq, err := OpenAIToClaude(req)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+
+	blocks, ok := claudeReq.Messages[0].Content.([]types.ClaudeContentBlock)
+	if !ok || len(blocks) != 3 {
+		t.Fatalf("Expected text and two image blocks, got %+v", claudeReq.Messages[0].Content)
+	}
+	if text, ok := blocks[0].(types.ClaudeContentBlockText); !ok || text.Text != "Compare these" {
+		t.Errorf("Unexpected text block %+v", blocks[0])
+	}
+	want := types.ClaudeMediaSource{Type: "base64", MediaType: "image/png", Data: "iVBORw0KGgo="}
+	if image, ok := blocks[1].(types.ClaudeContentBlockImage); !ok || image.Source != want {
+		t.Errorf("Expected a base64 image from the data URL, got %+v", blocks[1])
+	}
+	want = types.ClaudeMediaSource{Type: "url", URL: "https://example.com/cat.jpg"}
+	if image, ok := blocks[2].(types.ClaudeContentBlockImage); !ok || image.Source != want {
+		t.Errorf("Expected a url image, got %+v", blocks[2])
+	}
+
+	// Images get the same IMAGE_MODE handling as /v1/messages
+	previous := types.ImageHandling
+	defer func() { types.ImageHandling = previous }()
+	types.ImageHandling = types.ImageModePlaceholder
+	if text := ExtractTextFromContent(blocks); !strings.Contains(text, "[image omitted: image/png]") {
+		t.Errorf("Expected an image placeholder, got %q", text)
+	}
+	types.ImageHandling = types.ImageModeReject
+	if err := CheckMedia(claudeReq); err == nil {
+		t.Error("Expected the image to be rejected")
+	}
+}
+
+func TestOpenAIToClaude_InvalidImageURL(t *testing.T) {
+	for _, imageURL := range []string{"file:///etc/passwd", "data:image/png,raw", ""} {
+		req := types.OpenAIChatRequest{
+			Model: "claude-opus-4-5",
+			Messages: []types.OpenAIMessage{
+				{Role: "user", Content: []interface{}{
+					map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": imageURL}},
+				}},
+			},
+		}
+		if _, err := OpenAIToClaude(req); err == nil {
+			t.Errorf("Expected %q to be rejected", imageURL)
+		}
+	}
+}
@@ -87,3 +87,31 @@ Example - Multiple tool calls:
 `, strings.Join(toolDescriptions, "\n\n"))
 	return instructions
 }
+
+// GenerateToolChoiceInstructions returns the instructions enforcing a tool
+// choice, appended to the tool instructions. Auto adds nothing.
+func GenerateToolChoiceInstructions(choice types.ToolChoice) string {
+	var rules []string
+	switch choice.Type {
+	case types.ToolChoiceAny:
+		rules = append(rules, "!!! IMPORTANT: In this reply you MUST call at least one of the tools above using the <function_calls> format. Do not reply with text only.")
+	case types.ToolChoiceTool:
+		rules = append(rules, fmt.Sprintf("!!! IMPORTANT: In this reply you MUST call the tool %s using the <function_calls> format. Do not reply with text only.", choice.Name))
+	}
+	if choice.DisableParallelToolUse {
+		rules = append(rules, "!!! IMPORTANT: Call at most one tool in this reply: output a single <invoke> block, then stop.")
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return "\n" + strings.Join(rules, "\n") + "\n"
+}
+
+// ToolChoiceReminder returns the message re-prompting the model when its
+// reply is missing the tool call required by the tool choice
+func ToolChoiceReminder(choice types.ToolChoice) string {
+	if choice.Type == types.ToolChoiceTool {
+		return fmt.Sprintf("You did not call the tool %s. Call it now using the <function_calls> format, without any other text.", choice.Name)
+	}
+	return "You did not call a tool. Call one of the available tools now using the <function_calls> format, without any other text."
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/middleware"
+	"opus-api/internal/model"
+	"opus-api/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler API Key 管理处理器
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+	authService   *service.AuthService
+}
+
+// NewAPIKeyHandler 创建 API Key 处理器
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService, authService *service.AuthService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService, authService: authService}
+}
+
+// CreateAPIKeyRequest 创建 API Key 请求
+type CreateAPIKeyRequest struct {
+	Name                string `json:"name" binding:"required"`
+	OwnCookiesOnly      bool   `json:"own_cookies_only"`
+	CookiePool          string `json:"cookie_pool"`
+	AllowCookieOverride bool   `json:"allow_cookie_override"`
+}
+
+// APIKeyResponse API Key 响应
+type APIKeyResponse struct {
+	ID                  uint   `json:"id"`
+	Name                string `json:"name"`
+	KeyPrefix           string `json:"key_prefix"`
+	Key                 string `json:"key,omitempty"` // 仅在创建时返回
+	OwnCookiesOnly      bool   `json:"own_cookies_only"`
+	CookiePool          string `json:"cookie_pool,omitempty"`
+	AllowCookieOverride bool   `json:"allow_cookie_override"`
+	UsageCount          int64  `json:"usage_count"`
+	Revoked             bool   `json:"revoked"`
+	LastUsed            string `json:"last_used,omitempty"`
+	RevokedAt           string `json:"revoked_at,omitempty"`
+	CreatedAt           string `json:"created_at"`
+}
+
+// ListKeys 获取 API Key 列表
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	keys, err := h.apiKeyService.ListKeys(userID)
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to list api keys"))
+		return
+	}
+
+	response := make([]APIKeyResponse, len(keys))
+	for i, key := range keys {
+		response[i] = toAPIKeyResponse(&key)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateKey 创建 API Key
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	// 指定上游 Cookie 会绕过轮询和限流，只有管理员可以授权
+	if req.AllowCookieOverride {
+		user, err := h.authService.GetUserByID(userID)
+		if err != nil || !user.IsAdmin {
+			apierror.Write(c, apierror.Permission("only administrators can allow cookie override"))
+			return
+		}
+	}
+
+	key, rawKey, err := h.apiKeyService.CreateKey(userID, req.Name, service.APIKeyOptions{
+		OwnCookiesOnly:      req.OwnCookiesOnly,
+		CookiePool:          req.CookiePool,
+		AllowCookieOverride: req.AllowCookieOverride,
+	})
+	if err != nil {
+		if err == service.ErrInvalidKeyPool {
+			apierror.Write(c, apierror.InvalidRequest("pool name is too long"))
+			return
+		}
+		apierror.Write(c, apierror.Internal("failed to create api key"))
+		return
+	}
+
+	response := toAPIKeyResponse(key)
+	response.Key = rawKey
+	c.JSON(http.StatusCreated, response)
+}
+
+// RevokeKey 吊销 API Key
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apierror.Write(c, apierror.InvalidRequest("invalid id"))
+		return
+	}
+
+	if err := h.apiKeyService.RevokeKey(uint(id), userID); err != nil {
+		if err == service.ErrAPIKeyNotFound {
+			apierror.Write(c, apierror.NotFound("api key not found"))
+			return
+		}
+		apierror.Write(c, apierror.Internal("failed to revoke api key"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
+
+// toAPIKeyResponse 转换为响应格式
+func toAPIKeyResponse(key *model.APIKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:                  key.ID,
+		Name:                key.Name,
+		KeyPrefix:           key.KeyPrefix,
+		OwnCookiesOnly:      key.OwnCookiesOnly,
+		CookiePool:          key.CookiePool,
+		AllowCookieOverride: key.AllowCookieOverride,
+		UsageCount:          key.UsageCount,
+		Revoked:             key.IsRevoked(),
+		CreatedAt:           key.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if key.LastUsed != nil {
+		resp.LastUsed = key.LastUsed.Format("2006-01-02 15:04:05")
+	}
+	if key.RevokedAt != nil {
+		resp.RevokedAt = key.RevokedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"opus-api/internal/apierror"
 	"opus-api/internal/middleware"
 	"opus-api/internal/service"
 	"opus-api/internal/types"
@@ -35,19 +36,20 @@ type LoginResponse struct {
 type User struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
 }
 
 // Login 登录
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
 		return
 	}
 
 	user, token, err := h.authService.Login(req.Username, req.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		apierror.Write(c, apierror.Authentication("invalid username or password"))
 		return
 	}
 
@@ -56,6 +58,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		User: User{
 			ID:       user.ID,
 			Username: user.Username,
+			IsAdmin:  user.IsAdmin,
 		},
 	})
 }
@@ -64,12 +67,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 func (h *AuthHandler) Logout(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	if err := h.authService.Logout(userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		apierror.Write(c, apierror.Internal("failed to logout"))
 		return
 	}
 
@@ -80,19 +83,20 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 func (h *AuthHandler) Me(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	user, err := h.authService.GetUserByID(userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		apierror.Write(c, apierror.NotFound("user not found"))
 		return
 	}
 
 	c.JSON(http.StatusOK, User{
 		ID:       user.ID,
 		Username: user.Username,
+		IsAdmin:  user.IsAdmin,
 	})
 }
 
@@ -100,24 +104,24 @@ func (h *AuthHandler) Me(c *gin.Context) {
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	var req types.ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		apierror.Write(c, apierror.InvalidRequest("请求参数错误: "+err.Error()))
 		return
 	}
 
 	// 从上下文获取当前用户ID
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	// 修改密码
 	if err := h.authService.ChangePassword(userID, req.OldPassword, req.NewPassword); err != nil {
 		if err == service.ErrInvalidCredentials {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "原密码错误"})
+			apierror.Write(c, apierror.InvalidRequest("原密码错误"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码修改失败"})
+		apierror.Write(c, apierror.Internal("密码修改失败"))
 		return
 	}
 
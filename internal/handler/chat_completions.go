@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/converter"
+	"opus-api/internal/logger"
+	"opus-api/internal/stream"
+	"opus-api/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// HandleChatCompletions handles POST /v1/chat/completions (OpenAI compatible)
+func HandleChatCompletions(c *gin.Context) {
+	// Generate request ID
+	requestID := uuid.New().String()[:8]
+
+	// Rotate logs before creating new folder
+	if types.DebugMode {
+		logger.RotateLogs()
+	}
+
+	// Parse OpenAI request
+	var openAIReq types.OpenAIChatRequest
+	if err := c.ShouldBindJSON(&openAIReq); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request format")
+		return
+	}
+
+	// Convert to Claude format
+	claudeReq, err := converter.OpenAIToClaude(openAIReq)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	// 验证模型是否支持
+	if err := resolveRequestModel(&claudeReq); err != nil {
+		openAIError(c, err.Status, err.Type, err.Message)
+		return
+	}
+
+	// IMAGE_MODE=reject 时拒绝包含图片的请求
+	if err := converter.CheckMedia(claudeReq); err != nil {
+		openAIError(c, http.StatusBadRequest, apierror.TypeInvalidRequest, err.Error())
+		return
+	}
+
+	cookieOverride, apiErr := cookieOverrideFor(c)
+	if apiErr != nil {
+		openAIError(c, apiErr.Status, apiErr.Type, apiErr.Message)
+		return
+	}
+
+	// Log Point 1: OpenAI request and the Claude request derived from it
+	var logFolder string
+	if types.DebugMode {
+		logFolder, _ = logger.CreateLogFolder(requestID)
+		logger.WriteJSONLog(logFolder, "0_openai_request.json", openAIReq)
+		logger.WriteJSONLog(logFolder, "1_claude_request.json", claudeReq)
+	}
+
+	selector := cookieSelectorFor(c, claudeReq)
+	reopen := func(req types.ClaudeRequest) (*upstreamSession, error) {
+		return openUpstreamSession(c.Request.Context(), req, selector, cookieOverride, logFolder)
+	}
+	session, err := reopen(claudeReq)
+	if err != nil {
+		apiErr := toAPIError(err)
+		openAIError(c, apiErr.Status, apiErr.Type, apiErr.Message)
+		return
+	}
+	defer session.Close()
+
+	if !openAIReq.Stream {
+		accumulator := stream.NewMessageAccumulator(claudeReq.Model, session.InputTokens)
+		if err := transformResponse(claudeReq, session, reopen, accumulator); err != nil {
+			log.Printf("[ERROR] Stream transformation error: %v", err)
+			openAIError(c, http.StatusBadGateway, apierror.TypeAPI, "Failed to read upstream response: "+err.Error())
+			return
+		}
+
+		message := accumulator.Message()
+		completion := stream.MessageToChatCompletion(message, claudeReq.Model)
+
+		// Log Point 5: Client response
+		if types.DebugMode && logFolder != "" {
+			logger.WriteJSONLog(logFolder, "5_client_response.json", completion)
+		}
+
+		c.JSON(http.StatusOK, completion)
+		return
+	}
+
+	includeUsage := openAIReq.StreamOptions != nil && openAIReq.StreamOptions.IncludeUsage
+	streamToClient(c, logFolder, func(w io.Writer, onChunk func(string)) error {
+		openAIWriter := stream.NewOpenAIStreamWriter(w, claudeReq.Model, includeUsage, onChunk)
+		err := transformResponse(claudeReq, session, reopen, openAIWriter)
+		if err != nil {
+			// Headers are already sent, report the failure in-band
+			frame := fmt.Sprintf("data: %s\n\n", mustMarshalOpenAIError(apierror.TypeOverloaded, "Stream interrupted: "+err.Error()))
+			onChunk(frame)
+			w.Write([]byte(frame))
+		}
+		return err
+	})
+}
+
+// openAIError writes an error in the OpenAI error format
+func openAIError(c *gin.Context, status int, errType, message string) {
+	c.JSON(status, openAIErrorBody(errType, message))
+}
+
+func openAIErrorBody(errType, message string) gin.H {
+	return gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    nil,
+		},
+	}
+}
+
+func mustMarshalOpenAIError(errType, message string) string {
+	data, _ := json.Marshal(openAIErrorBody(errType, message))
+	return string(data)
+}
@@ -1,79 +1,113 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"log"
 	"net/http"
+	"opus-api/internal/apierror"
 	"opus-api/internal/middleware"
 	"opus-api/internal/model"
 	"opus-api/internal/service"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxPoolNameLength Cookie 池名称的最大长度
+const maxPoolNameLength = 50
+
 // CookieHandler Cookie 管理处理器
 type CookieHandler struct {
 	cookieService *service.CookieService
 	validator     *service.CookieValidator
+	limiter       *service.CookieLimiter
 }
 
 // NewCookieHandler 创建 Cookie 处理器
-func NewCookieHandler(cookieService *service.CookieService, validator *service.CookieValidator) *CookieHandler {
+func NewCookieHandler(cookieService *service.CookieService, validator *service.CookieValidator, limiter *service.CookieLimiter) *CookieHandler {
 	return &CookieHandler{
 		cookieService: cookieService,
 		validator:     validator,
+		limiter:       limiter,
 	}
 }
 
 // CreateCookieRequest 创建 Cookie 请求
 type CreateCookieRequest struct {
-	Name       string `json:"name" binding:"required"`
-	APIKey     string `json:"api_key" binding:"required"`
-	SessionKey string `json:"session_key"`
-	Priority   int    `json:"priority"`
+	Name            string `json:"name" binding:"required"`
+	APIKey          string `json:"api_key" binding:"required"`
+	SessionKey      string `json:"session_key"`
+	Priority        int    `json:"priority"`
+	Pool            string `json:"pool"`
+	RPMLimit        int    `json:"rpm_limit"`
+	DailyTokenLimit int64  `json:"daily_token_limit"`
+	MaxConcurrent   int    `json:"max_concurrent"`
 }
 
 // UpdateCookieRequest 更新 Cookie 请求
 type UpdateCookieRequest struct {
-	Name       string `json:"name"`
-	APIKey     string `json:"api_key"`
-	SessionKey string `json:"session_key"`
-	Priority   *int   `json:"priority"`
-	IsValid    *bool  `json:"is_valid"`
+	Name            string `json:"name"`
+	APIKey          string `json:"api_key"`
+	SessionKey      string `json:"session_key"`
+	Priority        *int   `json:"priority"`
+	IsValid         *bool  `json:"is_valid"`
+	Pool            string `json:"pool"`
+	RPMLimit        *int   `json:"rpm_limit"`
+	DailyTokenLimit *int64 `json:"daily_token_limit"`
+	MaxConcurrent   *int   `json:"max_concurrent"`
+}
+
+// UpdatePoolRequest 更新 Cookie 池请求
+type UpdatePoolRequest struct {
+	Shared *bool `json:"shared" binding:"required"`
 }
 
 // CookieResponse Cookie 响应
 type CookieResponse struct {
-	ID            uint   `json:"id"`
-	Name          string `json:"name"`
-	APIKey        string `json:"api_key"`
-	SessionKey    string `json:"session_key"`
-	IsValid       bool   `json:"is_valid"`
-	Priority      int    `json:"priority"`
-	UsageCount    int64  `json:"usage_count"`
-	ErrorCount    int    `json:"error_count"`
-	LastUsed      string `json:"last_used,omitempty"`
-	LastValidated string `json:"last_validated,omitempty"`
-	CreatedAt     string `json:"created_at"`
-	UpdatedAt     string `json:"updated_at"`
+	ID              uint   `json:"id"`
+	Name            string `json:"name"`
+	Pool            string `json:"pool"`
+	APIKey          string `json:"api_key"`
+	SessionKey      string `json:"session_key"`
+	IsValid         bool   `json:"is_valid"`
+	Priority        int    `json:"priority"`
+	RPMLimit        int    `json:"rpm_limit"`
+	DailyTokenLimit int64  `json:"daily_token_limit"`
+	MaxConcurrent   int    `json:"max_concurrent"`
+	InFlight        int    `json:"in_flight"`    // 进行中的请求数（进程内）
+	TokensToday     int64  `json:"tokens_today"` // 当天已使用的 Token 数（进程内）
+	UsageCount      int64  `json:"usage_count"`
+	ErrorCount      int    `json:"error_count"`
+	CoolingDown     bool   `json:"cooling_down"`
+	CooldownUntil   string `json:"cooldown_until,omitempty"` // RFC3339，用于前端倒计时
+	LastError       string `json:"last_error,omitempty"`
+	LastErrorAt     string `json:"last_error_at,omitempty"`
+	LastUsed        string `json:"last_used,omitempty"`
+	LastValidated   string `json:"last_validated,omitempty"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
 }
 
 // ListCookies 获取 Cookie 列表
 func (h *CookieHandler) ListCookies(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	cookies, err := h.cookieService.ListCookies(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list cookies"})
+		apierror.Write(c, apierror.Internal("failed to list cookies"))
 		return
 	}
 
 	responses := make([]CookieResponse, len(cookies))
 	for i, cookie := range cookies {
-		responses[i] = toCookieResponse(&cookie)
+		responses[i] = h.toCookieResponseWithLoad(&cookie)
 	}
 
 	c.JSON(http.StatusOK, responses)
@@ -83,55 +117,71 @@ func (h *CookieHandler) ListCookies(c *gin.Context) {
 func (h *CookieHandler) GetCookie(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		apierror.Write(c, apierror.InvalidRequest("invalid id"))
 		return
 	}
 
 	cookie, err := h.cookieService.GetCookie(uint(id), userID)
 	if err != nil {
 		if err == service.ErrCookieNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "cookie not found"})
+			apierror.Write(c, apierror.NotFound("cookie not found"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cookie"})
+		apierror.Write(c, apierror.Internal("failed to get cookie"))
 		return
 	}
 
-	c.JSON(http.StatusOK, toCookieResponse(cookie))
+	c.JSON(http.StatusOK, h.toCookieResponseWithLoad(cookie))
 }
 
 // CreateCookie 创建 Cookie
 func (h *CookieHandler) CreateCookie(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	var req CreateCookieRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	if req.Pool == "" {
+		req.Pool = model.DefaultPool
+	}
+	if len(req.Pool) > maxPoolNameLength {
+		apierror.Write(c, apierror.InvalidRequest("pool name is too long"))
+		return
+	}
+	if req.RPMLimit < 0 || req.DailyTokenLimit < 0 || req.MaxConcurrent < 0 {
+		apierror.Write(c, apierror.InvalidRequest("limits must not be negative"))
 		return
 	}
 
 	cookie := &model.MorphCookie{
-		UserID:     userID,
-		Name:       req.Name,
-		APIKey:     req.APIKey,
-		SessionKey: req.SessionKey,
-		Priority:   req.Priority,
-		IsValid:    true, // 默认有效，可以通过验证接口验证
+		UserID:          userID,
+		Name:            req.Name,
+		Pool:            req.Pool,
+		APIKey:          req.APIKey,
+		SessionKey:      req.SessionKey,
+		Priority:        req.Priority,
+		RPMLimit:        req.RPMLimit,
+		DailyTokenLimit: req.DailyTokenLimit,
+		MaxConcurrent:   req.MaxConcurrent,
+		IsValid:         true, // 默认有效，可以通过验证接口验证
 	}
 
 	if err := h.cookieService.CreateCookie(cookie); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create cookie"})
+		apierror.Write(c, apierror.Internal("failed to create cookie"))
 		return
 	}
 
@@ -142,30 +192,30 @@ func (h *CookieHandler) CreateCookie(c *gin.Context) {
 func (h *CookieHandler) UpdateCookie(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		apierror.Write(c, apierror.InvalidRequest("invalid id"))
 		return
 	}
 
 	cookie, err := h.cookieService.GetCookie(uint(id), userID)
 	if err != nil {
 		if err == service.ErrCookieNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "cookie not found"})
+			apierror.Write(c, apierror.NotFound("cookie not found"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cookie"})
+		apierror.Write(c, apierror.Internal("failed to get cookie"))
 		return
 	}
 
 	var req UpdateCookieRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
 		return
 	}
 
@@ -173,10 +223,11 @@ func (h *CookieHandler) UpdateCookie(c *gin.Context) {
 	if req.Name != "" {
 		cookie.Name = req.Name
 	}
-	if req.APIKey != "" {
+	// 忽略原样提交回来的掩码值，避免用掩码覆盖真实密钥
+	if req.APIKey != "" && req.APIKey != maskSecret(cookie.APIKey) {
 		cookie.APIKey = req.APIKey
 	}
-	if req.SessionKey != "" {
+	if req.SessionKey != "" && req.SessionKey != maskSecret(cookie.SessionKey) {
 		cookie.SessionKey = req.SessionKey
 	}
 	if req.Priority != nil {
@@ -185,36 +236,58 @@ func (h *CookieHandler) UpdateCookie(c *gin.Context) {
 	if req.IsValid != nil {
 		cookie.IsValid = *req.IsValid
 	}
+	if req.Pool != "" {
+		if len(req.Pool) > maxPoolNameLength {
+			apierror.Write(c, apierror.InvalidRequest("pool name is too long"))
+			return
+		}
+		cookie.Pool = req.Pool
+	}
+	if (req.RPMLimit != nil && *req.RPMLimit < 0) ||
+		(req.DailyTokenLimit != nil && *req.DailyTokenLimit < 0) ||
+		(req.MaxConcurrent != nil && *req.MaxConcurrent < 0) {
+		apierror.Write(c, apierror.InvalidRequest("limits must not be negative"))
+		return
+	}
+	if req.RPMLimit != nil {
+		cookie.RPMLimit = *req.RPMLimit
+	}
+	if req.DailyTokenLimit != nil {
+		cookie.DailyTokenLimit = *req.DailyTokenLimit
+	}
+	if req.MaxConcurrent != nil {
+		cookie.MaxConcurrent = *req.MaxConcurrent
+	}
 
 	if err := h.cookieService.UpdateCookie(cookie); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update cookie"})
+		apierror.Write(c, apierror.Internal("failed to update cookie"))
 		return
 	}
 
-	c.JSON(http.StatusOK, toCookieResponse(cookie))
+	c.JSON(http.StatusOK, h.toCookieResponseWithLoad(cookie))
 }
 
 // DeleteCookie 删除 Cookie
 func (h *CookieHandler) DeleteCookie(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		apierror.Write(c, apierror.InvalidRequest("invalid id"))
 		return
 	}
 
 	if err := h.cookieService.DeleteCookie(uint(id), userID); err != nil {
 		if err == service.ErrCookieNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "cookie not found"})
+			apierror.Write(c, apierror.NotFound("cookie not found"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete cookie"})
+		apierror.Write(c, apierror.Internal("failed to delete cookie"))
 		return
 	}
 
@@ -225,24 +298,24 @@ func (h *CookieHandler) DeleteCookie(c *gin.Context) {
 func (h *CookieHandler) ValidateCookie(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		apierror.Write(c, apierror.InvalidRequest("invalid id"))
 		return
 	}
 
 	cookie, err := h.cookieService.GetCookie(uint(id), userID)
 	if err != nil {
 		if err == service.ErrCookieNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "cookie not found"})
+			apierror.Write(c, apierror.NotFound("cookie not found"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get cookie"})
+		apierror.Write(c, apierror.Internal("failed to get cookie"))
 		return
 	}
 
@@ -254,51 +327,315 @@ func (h *CookieHandler) ValidateCookie(c *gin.Context) {
 	})
 }
 
-// ValidateAllCookies 验证所有 Cookie
-func (h *CookieHandler) ValidateAllCookies(c *gin.Context) {
+// maxValidationHistory 验证历史接口返回的最大记录数
+const maxValidationHistory = 50
+
+// ValidationResponse 验证历史记录响应
+type ValidationResponse struct {
+	ID         uint   `json:"id"`
+	Source     string `json:"source"`
+	IsValid    bool   `json:"is_valid"`
+	StatusCode int    `json:"status_code"`
+	LatencyMs  int64  `json:"latency_ms"`
+	Error      string `json:"error"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ListValidations 获取 Cookie 最近的验证历史
+func (h *CookieHandler) ListValidations(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		apierror.Write(c, apierror.InvalidRequest("invalid id"))
+		return
+	}
+
+	cookie, err := h.cookieService.GetCookie(uint(id), userID)
+	if err != nil {
+		if err == service.ErrCookieNotFound {
+			apierror.Write(c, apierror.NotFound("cookie not found"))
+			return
+		}
+		apierror.Write(c, apierror.Internal("failed to get cookie"))
+		return
+	}
+
+	validations, err := h.validator.ListValidations(cookie.ID, maxValidationHistory)
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to list validations"))
+		return
+	}
+
+	response := make([]ValidationResponse, len(validations))
+	for i, v := range validations {
+		response[i] = ValidationResponse{
+			ID:         v.ID,
+			Source:     v.Source,
+			IsValid:    v.IsValid,
+			StatusCode: v.StatusCode,
+			LatencyMs:  v.LatencyMs,
+			Error:      v.Error,
+			CreatedAt:  v.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// maxImportSize 导入数据的最大字节数
+const maxImportSize = 5 << 20
+
+// ImportCookies 批量导入 Cookie，支持 JSON、CSV 和每行一个 Cookie 的纯文本
+// 查询参数：format（json/csv/lines，默认自动识别）、pool（未指定池的行使用）、validate（导入后立即验证）
+func (h *CookieHandler) ImportCookies(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxImportSize+1))
+	if err != nil {
+		apierror.Write(c, apierror.InvalidRequest("failed to read request body"))
+		return
+	}
+	if len(data) > maxImportSize {
+		apierror.Write(c, apierror.InvalidRequest("import data is too large"))
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = service.DetectImportFormat(data)
+	}
+
+	pool := c.Query("pool")
+	if len(pool) > maxPoolNameLength {
+		apierror.Write(c, apierror.InvalidRequest("pool name is too long"))
+		return
+	}
+
+	rows, err := service.ParseImport(format, data)
+	if err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+	if len(rows) == 0 {
+		apierror.Write(c, apierror.InvalidRequest("no cookies found in import data"))
+		return
+	}
+
+	results, err := h.cookieService.ImportCookies(userID, rows, pool)
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to import cookies"))
 		return
 	}
 
-	results := h.validator.ValidateAllCookies(userID)
+	if c.Query("validate") == "true" {
+		h.validator.ValidateImported(c.Request.Context(), userID, results)
+	}
+
+	summary := gin.H{
+		service.ImportStatusCreated:   0,
+		service.ImportStatusDuplicate: 0,
+		service.ImportStatusInvalid:   0,
+		service.ImportStatusError:     0,
+	}
+	for _, result := range results {
+		summary[result.Status] = summary[result.Status].(int) + 1
+	}
 
 	c.JSON(http.StatusOK, gin.H{
+		"format":  format,
+		"summary": summary,
 		"results": results,
 	})
 }
 
+// ExportedCookie 导出的 Cookie，字段与导入格式一致，未请求时不包含密钥
+type ExportedCookie struct {
+	Name            string `json:"name"`
+	Pool            string `json:"pool"`
+	Priority        int    `json:"priority"`
+	RPMLimit        int    `json:"rpm_limit"`
+	DailyTokenLimit int64  `json:"daily_token_limit"`
+	MaxConcurrent   int    `json:"max_concurrent"`
+	IsValid         bool   `json:"is_valid"`
+	APIKey          string `json:"api_key,omitempty"`
+	SessionKey      string `json:"session_key,omitempty"`
+}
+
+// ExportCookies 导出 Cookie，只有 include_secrets=true 时才包含 api_key 和 session_key
+// 查询参数 format 为 json（默认）或 csv
+func (h *CookieHandler) ExportCookies(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	format := c.DefaultQuery("format", service.ImportFormatJSON)
+	if format != service.ImportFormatJSON && format != service.ImportFormatCSV {
+		apierror.Write(c, apierror.InvalidRequest("format must be json or csv"))
+		return
+	}
+	includeSecrets := c.Query("include_secrets") == "true"
+
+	cookies, err := h.cookieService.ListCookies(userID)
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to list cookies"))
+		return
+	}
+
+	exported := make([]ExportedCookie, len(cookies))
+	for i, cookie := range cookies {
+		exported[i] = ExportedCookie{
+			Name:            cookie.Name,
+			Pool:            cookie.Pool,
+			Priority:        cookie.Priority,
+			RPMLimit:        cookie.RPMLimit,
+			DailyTokenLimit: cookie.DailyTokenLimit,
+			MaxConcurrent:   cookie.MaxConcurrent,
+			IsValid:         cookie.IsValid,
+		}
+		if includeSecrets {
+			exported[i].APIKey = cookie.APIKey
+			exported[i].SessionKey = cookie.SessionKey
+		}
+	}
+	if includeSecrets {
+		log.Printf("[INFO] User %d exported %d cookie(s) with secrets", userID, len(cookies))
+	}
+
+	filename := "cookies-" + time.Now().Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == service.ImportFormatJSON {
+		c.JSON(http.StatusOK, exported)
+		return
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header := []string{"name", "pool", "priority", "rpm_limit", "daily_token_limit", "max_concurrent", "is_valid"}
+	if includeSecrets {
+		header = append(header, "api_key", "session_key")
+	}
+	writer.Write(header)
+	for _, cookie := range exported {
+		record := []string{
+			cookie.Name, cookie.Pool, strconv.Itoa(cookie.Priority),
+			strconv.Itoa(cookie.RPMLimit), strconv.FormatInt(cookie.DailyTokenLimit, 10), strconv.Itoa(cookie.MaxConcurrent),
+			strconv.FormatBool(cookie.IsValid),
+		}
+		if includeSecrets {
+			record = append(record, cookie.APIKey, cookie.SessionKey)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// CookieStatsResponse 统计信息及进程内的 Cookie 负载
+type CookieStatsResponse struct {
+	*model.CookieStats
+	InFlight int                         `json:"in_flight"` // 所有 Cookie 进行中的请求数
+	Cookies  map[uint]service.CookieLoad `json:"cookies"`   // 按 Cookie ID，只包含有记录的 Cookie
+}
+
 // GetStats 获取统计信息
 func (h *CookieHandler) GetStats(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		apierror.Write(c, apierror.Authentication("unauthorized"))
 		return
 	}
 
 	stats, err := h.cookieService.GetStats(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get stats"})
+		apierror.Write(c, apierror.Internal("failed to get stats"))
+		return
+	}
+
+	resp := CookieStatsResponse{CookieStats: stats, Cookies: map[uint]service.CookieLoad{}}
+	if h.limiter != nil {
+		ids, err := h.cookieService.CookieIDs(userID)
+		if err != nil {
+			apierror.Write(c, apierror.Internal("failed to get stats"))
+			return
+		}
+		snapshot := h.limiter.Snapshot()
+		for _, id := range ids {
+			if load, ok := snapshot[id]; ok {
+				resp.Cookies[id] = load
+				resp.InFlight += load.InFlight
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListPools 获取 Cookie 池列表
+func (h *CookieHandler) ListPools(c *gin.Context) {
+	pools, err := h.cookieService.ListPools()
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to list pools"))
+		return
+	}
+
+	c.JSON(http.StatusOK, pools)
+}
+
+// UpdatePool 设置 Cookie 池是否共享
+func (h *CookieHandler) UpdatePool(c *gin.Context) {
+	name := c.Param("name")
+	if name == "" || len(name) > maxPoolNameLength {
+		apierror.Write(c, apierror.InvalidRequest("invalid pool name"))
+		return
+	}
+
+	var req UpdatePoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	pool, err := h.cookieService.SetPoolShared(name, *req.Shared)
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to update pool"))
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
+	c.JSON(http.StatusOK, pool)
 }
 
 // toCookieResponse 转换为响应格式
 func toCookieResponse(cookie *model.MorphCookie) CookieResponse {
 	resp := CookieResponse{
-		ID:         cookie.ID,
-		Name:       cookie.Name,
-		APIKey:     maskAPIKey(cookie.APIKey),
-		SessionKey: cookie.SessionKey,
-		IsValid:    cookie.IsValid,
-		Priority:   cookie.Priority,
-		UsageCount: cookie.UsageCount,
-		ErrorCount: cookie.ErrorCount,
-		CreatedAt:  cookie.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt:  cookie.UpdatedAt.Format("2006-01-02 15:04:05"),
+		ID:              cookie.ID,
+		Name:            cookie.Name,
+		Pool:            cookie.Pool,
+		APIKey:          maskSecret(cookie.APIKey),
+		SessionKey:      maskSecret(cookie.SessionKey),
+		IsValid:         cookie.IsValid,
+		Priority:        cookie.Priority,
+		RPMLimit:        cookie.RPMLimit,
+		DailyTokenLimit: cookie.DailyTokenLimit,
+		MaxConcurrent:   cookie.MaxConcurrent,
+		UsageCount:      cookie.UsageCount,
+		ErrorCount:      cookie.ErrorCount,
+		LastError:       cookie.LastError,
+		CreatedAt:       cookie.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:       cookie.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
 
 	if cookie.LastUsed != nil {
@@ -307,14 +644,35 @@ func toCookieResponse(cookie *model.MorphCookie) CookieResponse {
 	if cookie.LastValidated != nil {
 		resp.LastValidated = cookie.LastValidated.Format("2006-01-02 15:04:05")
 	}
+	if cookie.IsCoolingDown() {
+		resp.CoolingDown = true
+		resp.CooldownUntil = cookie.CooldownUntil.Format(time.RFC3339)
+	}
+	if cookie.LastErrorAt != nil {
+		resp.LastErrorAt = cookie.LastErrorAt.Format("2006-01-02 15:04:05")
+	}
+
+	return resp
+}
 
+// toCookieResponseWithLoad 转换为响应格式，并附带 Cookie 当前的负载
+func (h *CookieHandler) toCookieResponseWithLoad(cookie *model.MorphCookie) CookieResponse {
+	resp := toCookieResponse(cookie)
+	if h.limiter != nil {
+		load := h.limiter.Load(cookie.ID)
+		resp.InFlight = load.InFlight
+		resp.TokensToday = load.TokensToday
+	}
 	return resp
 }
 
-// maskAPIKey 隐藏 API Key 中间部分
-func maskAPIKey(apiKey string) string {
-	if len(apiKey) <= 8 {
+// maskSecret 隐藏密钥中间部分，空值保持为空
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 8 {
 		return "****"
 	}
-	return apiKey[:4] + "****" + apiKey[len(apiKey)-4:]
+	return value[:4] + "****" + value[len(value)-4:]
 }
\ No newline at end of file
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/converter"
+	"opus-api/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountTokensResponse is the response of /v1/messages/count_tokens
+type CountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// HandleCountTokens handles POST /v1/messages/count_tokens
+func HandleCountTokens(c *gin.Context) {
+	var claudeReq types.ClaudeRequest
+	if err := c.ShouldBindJSON(&claudeReq); err != nil {
+		apierror.Write(c, apierror.InvalidRequest("Invalid request format: "+err.Error()))
+		return
+	}
+
+	if err := resolveRequestModel(&claudeReq); err != nil {
+		apierror.Write(c, err)
+		return
+	}
+
+	// IMAGE_MODE=reject 时拒绝包含图片或文档的请求
+	if err := converter.CheckMedia(claudeReq); err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, CountTokensResponse{
+		InputTokens: calculateInputTokens(claudeReq),
+	})
+}
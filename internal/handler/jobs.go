@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/middleware"
+	"opus-api/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobKeepAliveInterval SSE 保活注释的发送间隔
+const jobKeepAliveInterval = 15 * time.Second
+
+// JobHandler 后台任务处理器
+type JobHandler struct {
+	jobs *service.JobManager
+}
+
+// NewJobHandler 创建后台任务处理器
+func NewJobHandler(jobs *service.JobManager) *JobHandler {
+	return &JobHandler{jobs: jobs}
+}
+
+// ValidateAllCookies 启动批量验证任务，进度通过 /api/jobs/:id/events 获取
+func (h *JobHandler) ValidateAllCookies(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	job, err := h.jobs.StartValidateAll(userID)
+	if err != nil {
+		apierror.Write(c, apierror.Internal("failed to start validation"))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id": job.ID,
+		"total":  job.Total,
+	})
+}
+
+// Events 以 SSE 推送任务进度，连接时先回放已有事件，任务结束后关闭
+func (h *JobHandler) Events(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		apierror.Write(c, apierror.Authentication("unauthorized"))
+		return
+	}
+
+	job, err := h.jobs.GetJob(c.Param("id"), userID)
+	if err != nil {
+		apierror.Write(c, apierror.NotFound("job not found"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	keepAlive := time.NewTicker(jobKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	cursor := 0
+	c.Stream(func(w io.Writer) bool {
+		events, done, changed := job.Events(cursor)
+		if len(events) > 0 {
+			for _, event := range events {
+				c.SSEvent(event.Type, event)
+			}
+			cursor += len(events)
+			return !done
+		}
+		if done {
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-changed:
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+		}
+		return true
+	})
+}
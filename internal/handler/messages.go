@@ -1,19 +1,20 @@
 package handler
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"opus-api/internal/apierror"
 	"opus-api/internal/converter"
 	"opus-api/internal/logger"
-	"opus-api/internal/model"
+	"opus-api/internal/parser"
 	"opus-api/internal/stream"
 	"opus-api/internal/tokenizer"
 	"opus-api/internal/types"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -32,18 +33,25 @@ func HandleMessages(c *gin.Context) {
 	// Parse Claude request
 	var claudeReq types.ClaudeRequest
 	if err := c.ShouldBindJSON(&claudeReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		apierror.Write(c, apierror.InvalidRequest("Invalid request format: "+err.Error()))
 		return
 	}
 
 	// 验证模型是否支持
-	if claudeReq.Model == "" {
-		claudeReq.Model = types.DefaultModel
+	if err := resolveRequestModel(&claudeReq); err != nil {
+		apierror.Write(c, err)
+		return
 	}
-	if !types.IsModelSupported(claudeReq.Model) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Model '%s' is not supported. Supported models: %v", claudeReq.Model, types.SupportedModels),
-		})
+
+	// IMAGE_MODE=reject 时拒绝包含图片或文档的请求
+	if err := converter.CheckMedia(claudeReq); err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	cookieOverride, apiErr := cookieOverrideFor(c)
+	if apiErr != nil {
+		apierror.Write(c, apiErr)
 		return
 	}
 
@@ -54,6 +62,74 @@ func HandleMessages(c *gin.Context) {
 		logger.WriteJSONLog(logFolder, "1_claude_request.json", claudeReq)
 	}
 
+	selector := cookieSelectorFor(c, claudeReq)
+	reopen := func(req types.ClaudeRequest) (*upstreamSession, error) {
+		return openUpstreamSession(c.Request.Context(), req, selector, cookieOverride, logFolder)
+	}
+	session, err := reopen(claudeReq)
+	if err != nil {
+		apierror.Write(c, toAPIError(err))
+		return
+	}
+	defer session.Close()
+
+	if !claudeReq.Stream {
+		// Non-streaming: drive the transformer into an accumulator and
+		// return the assembled message as a single JSON object
+		accumulator := stream.NewMessageAccumulator(claudeReq.Model, session.InputTokens)
+		if err := transformResponse(claudeReq, session, reopen, accumulator); err != nil {
+			log.Printf("[ERROR] Stream transformation error: %v", err)
+			apierror.Write(c, apierror.New(http.StatusBadGateway, apierror.TypeAPI, "Failed to read upstream response: "+err.Error()))
+			return
+		}
+
+		message := accumulator.Message()
+
+		// Log Point 5: Client response
+		if types.DebugMode && logFolder != "" {
+			logger.WriteJSONLog(logFolder, "5_client_response.json", message)
+		}
+
+		c.JSON(http.StatusOK, message)
+		return
+	}
+
+	streamToClient(c, logFolder, func(w io.Writer, onChunk func(string)) error {
+		err := transformResponse(claudeReq, session, reopen, io.MultiWriter(w, chunkWriter(onChunk)))
+		if err != nil {
+			// Headers are already sent, report the failure in-band
+			frame := apierror.Overloaded("Stream interrupted: " + err.Error()).SSEFrame()
+			onChunk(frame)
+			w.Write([]byte(frame))
+		}
+		return err
+	})
+}
+
+// upstreamSession is an accepted upstream response ready to be transformed
+type upstreamSession struct {
+	*upstreamResponse
+	Reader      io.Reader // response body, teed into the debug log
+	InputTokens int
+	usage       *stream.UsageCounter // output of this response, written by transformResponse
+	closeOnce   sync.Once
+}
+
+// Close releases the upstream response and the cookie's rate limit slot,
+// charging the cookie for the output transformed so far. Only the first
+// call has an effect, so the transformer goroutine and the handler can both
+// close the session.
+func (s *upstreamSession) Close() {
+	s.closeOnce.Do(func() {
+		s.upstreamResponse.Close()
+		releaseCookie(s.Cookie, s.InputTokens+s.usage.OutputTokens())
+	})
+}
+
+// openUpstreamSession converts the Claude request to the Morph format and
+// sends it upstream with the client's cookie override if given, otherwise
+// failing over between rotated cookies as needed
+func openUpstreamSession(ctx context.Context, claudeReq types.ClaudeRequest, selector types.CookieSelector, cookieOverride string, logFolder string) (*upstreamSession, error) {
 	// Convert to Morph format
 	morphReq := converter.ClaudeToMorph(claudeReq)
 
@@ -65,76 +141,86 @@ func HandleMessages(c *gin.Context) {
 	// Send request to MorphLLM API
 	morphReqJSON, err := json.Marshal(morphReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal request"})
-		return
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", types.MorphAPIURL, bytes.NewReader(morphReqJSON))
+	resp, err := sendUpstream(ctx, selector, cookieOverride, morphReqJSON, logFolder)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
-		return
+		log.Printf("[ERROR] %v", err)
+		if types.DebugMode && logFolder != "" {
+			logger.WriteTextLog(logFolder, "error.txt", err.Error())
+		}
+		return nil, err
 	}
 
-	// Set headers
-	headers := make(map[string]string)
-	for key, value := range types.MorphHeaders {
-		headers[key] = value
-	}
-
-	// 如果启用了 Cookie 轮询器，使用轮询的 Cookie
-	if types.CookieRotatorInstance != nil {
-		cookieInterface, err := types.CookieRotatorInstance.NextCookie()
-		if err == nil && cookieInterface != nil {
-			// 类型断言为 *model.MorphCookie
-			if cookie, ok := cookieInterface.(*model.MorphCookie); ok {
-				headers["cookie"] = cookie.APIKey
-				log.Printf("[INFO] Using rotated cookie (ID: %d, Priority: %d)", cookie.ID, cookie.Priority)
-			} else {
-				log.Printf("[WARN] Cookie type assertion failed, using default")
-			}
-		} else {
-			log.Printf("[WARN] Failed to get rotated cookie: %v, using default", err)
-		}
+	// Log Point 4: Upstream response
+	var morphResponseWriter io.Writer = io.Discard
+	if types.DebugMode && logFolder != "" {
+		logger.WriteTextLog(logFolder, "4_upstream_response.txt", "")
+		morphResponseWriter = &logWriter{logFolder: logFolder, fileName: "4_upstream_response.txt"}
 	}
 
-	// 应用所有请求头
-	for key, value := range headers {
-		req.Header.Set(key, value)
+	return &upstreamSession{
+		upstreamResponse: resp,
+		Reader:           io.TeeReader(resp.Body, morphResponseWriter),
+		// Calculate input tokens from the converted request
+		InputTokens: countMorphTokens(morphReq),
+		usage:       stream.NewUsageCounter(),
+	}, nil
+}
+
+// transformOptionsFor describes the request for the stream transformer
+func transformOptionsFor(claudeReq types.ClaudeRequest) stream.TransformOptions {
+	return stream.TransformOptions{
+		Tools:      parser.NewToolSchemas(claudeReq.Tools),
+		Policy:     types.ToolPolicy,
+		ToolChoice: claudeReq.GetToolChoice(),
 	}
+}
 
-	// Log Point 3: Upstream request with headers
-	if types.DebugMode && logFolder != "" {
-		var reqLog strings.Builder
-		reqLog.WriteString(fmt.Sprintf("%s %s\n", req.Method, req.URL))
-		for k, v := range req.Header {
-			reqLog.WriteString(fmt.Sprintf("%s: %s\n", k, strings.Join(v, ", ")))
-		}
-		reqLog.WriteString("\n")
-		reqLog.Write(morphReqJSON)
-		logger.WriteTextLog(logFolder, "3_upstream_request.txt", reqLog.String())
+// transformResponse transforms the session's response into writer. When the
+// tool choice requires a tool call, the output is held back until the
+// required tool_use block starts. A response that ends without it is
+// discarded and the request is re-sent once through reopen with a reminder
+// appended; the second response is written as it is. Each session is
+// charged for its own output: the discarded session is closed before the
+// retry is sent, and the retry session is closed before returning. The
+// caller still closes session.
+func transformResponse(claudeReq types.ClaudeRequest, session *upstreamSession, reopen func(types.ClaudeRequest) (*upstreamSession, error), writer io.Writer) error {
+	options := transformOptionsFor(claudeReq)
+	if len(claudeReq.Tools) == 0 || !options.ToolChoice.RequiresToolCall() {
+		return stream.TransformMorphToClaudeStream(session.Reader, claudeReq.Model, session.InputTokens, options, io.MultiWriter(writer, session.usage), nil)
 	}
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to upstream API"})
-		return
+	gate := stream.NewToolCallGate(writer, options.ToolChoice.Name)
+	err := stream.TransformMorphToClaudeStream(session.Reader, claudeReq.Model, session.InputTokens, options, io.MultiWriter(gate, session.usage), nil)
+	if err != nil || gate.Open() {
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		if types.DebugMode && logFolder != "" {
-			logger.WriteTextLog(logFolder, "error.txt", fmt.Sprintf("Error: %d %s\n%s", resp.StatusCode, resp.Status, string(bodyBytes)))
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to connect to upstream API",
-			"status": resp.StatusCode,
-		})
-		return
+	log.Printf("[WARN] Response is missing the tool call required by tool_choice %s, retrying", options.ToolChoice.Type)
+	retryReq := claudeReq
+	retryReq.Messages = append([]types.ClaudeMessage{}, claudeReq.Messages...)
+	if text := strings.TrimSpace(gate.Text()); text != "" {
+		retryReq.Messages = append(retryReq.Messages, types.ClaudeMessage{Role: "assistant", Content: text})
 	}
+	retryReq.Messages = append(retryReq.Messages, types.ClaudeMessage{Role: "user", Content: converter.ToolChoiceReminder(options.ToolChoice)})
+
+	// The first response is complete, free its cookie before taking another
+	session.Close()
+	retry, err := reopen(retryReq)
+	if err != nil {
+		// Better the response without the tool call than none at all
+		log.Printf("[WARN] Tool choice retry failed, returning the first response: %v", err)
+		return gate.Release()
+	}
+	defer retry.Close()
+	return stream.TransformMorphToClaudeStream(retry.Reader, claudeReq.Model, retry.InputTokens, options, io.MultiWriter(writer, retry.usage), nil)
+}
 
+// streamToClient runs transform in a goroutine and streams everything it
+// writes to the client as SSE, capturing the output in the debug log
+func streamToClient(c *gin.Context, logFolder string, transform func(w io.Writer, onChunk func(string)) error) {
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -152,9 +238,6 @@ func HandleMessages(c *gin.Context) {
 		}
 	}
 
-	// Calculate input tokens from request
-	inputTokens := calculateInputTokens(claudeReq)
-
 	// Create a pipe for streaming
 	pr, pw := io.Pipe()
 
@@ -162,18 +245,8 @@ func HandleMessages(c *gin.Context) {
 	go func() {
 		defer pw.Close()
 
-		// Log Point 4: Upstream response
-		var morphResponseWriter io.Writer = io.Discard
-		if types.DebugMode && logFolder != "" {
-			logger.WriteTextLog(logFolder, "4_upstream_response.txt", "")
-			morphResponseWriter = &logWriter{logFolder: logFolder, fileName: "4_upstream_response.txt"}
-		}
-
-		// Tee the response body
-		teeReader := io.TeeReader(resp.Body, morphResponseWriter)
-
 		// Transform stream
-		if err := stream.TransformMorphToClaudeStream(teeReader, claudeReq.Model, inputTokens, pw, onChunk); err != nil {
+		if err := transform(pw, onChunk); err != nil {
 			log.Printf("[ERROR] Stream transformation error: %v", err)
 		}
 	}()
@@ -187,6 +260,17 @@ func HandleMessages(c *gin.Context) {
 		}
 		return err == nil
 	})
+
+	// Unblock the transformer if the client went away early
+	pr.Close()
+}
+
+// chunkWriter passes everything written to it to an onChunk callback
+type chunkWriter func(string)
+
+func (f chunkWriter) Write(p []byte) (int, error) {
+	f(string(p))
+	return len(p), nil
 }
 
 // logWriter writes to log file
@@ -202,51 +286,19 @@ func (w *logWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// calculateInputTokens calculates the total input tokens from a Claude request
+// calculateInputTokens calculates the input tokens of a Claude request as
+// it is sent upstream: system prompt, injected tool instructions and messages
 func calculateInputTokens(req types.ClaudeRequest) int {
-	var totalText strings.Builder
-
-	// Add system prompt
-	if req.System != nil {
-		if sysStr, ok := req.System.(string); ok {
-			totalText.WriteString(sysStr)
-		} else if sysList, ok := req.System.([]interface{}); ok {
-			for _, item := range sysList {
-				if itemMap, ok := item.(map[string]interface{}); ok {
-					if text, ok := itemMap["text"].(string); ok {
-						totalText.WriteString(text)
-					}
-				}
-			}
-		}
-	}
-
-	// Add messages content
-	for _, msg := range req.Messages {
-		if content, ok := msg.Content.(string); ok {
-			totalText.WriteString(content)
-		} else if contentBlocks, ok := msg.Content.([]types.ClaudeContentBlock); ok {
-			for _, block := range contentBlocks {
-				if textBlock, ok := block.(types.ClaudeContentBlockText); ok {
-					totalText.WriteString(textBlock.Text)
-				} else if toolResult, ok := block.(types.ClaudeContentBlockToolResult); ok {
-					if resultStr, ok := toolResult.Content.(string); ok {
-						totalText.WriteString(resultStr)
-					}
-				}
-			}
-		}
-	}
+	return countMorphTokens(converter.ClaudeToMorph(req))
+}
 
-	// Add tools definitions
-	for _, tool := range req.Tools {
-		totalText.WriteString(tool.Name)
-		totalText.WriteString(tool.Description)
-		if tool.InputSchema != nil {
-			schemaBytes, _ := json.Marshal(tool.InputSchema)
-			totalText.Write(schemaBytes)
+// countMorphTokens counts the tokens of every text part in a Morph request
+func countMorphTokens(morphReq types.MorphRequest) int {
+	var totalText strings.Builder
+	for _, msg := range morphReq.Messages {
+		for _, part := range msg.Parts {
+			totalText.WriteString(part.Text)
 		}
 	}
-
 	return tokenizer.CountTokens(totalText.String())
-}
\ No newline at end of file
+}
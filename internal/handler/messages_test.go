@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"opus-api/internal/model"
+	"opus-api/internal/stream"
+	"opus-api/internal/types"
+	"strings"
+	"testing"
+)
+
+// morphStream builds a Morph SSE response streaming text
+func morphStream(text string) string {
+	delta, _ := json.Marshal(map[string]string{"type": "text-delta", "id": "0", "delta": text})
+	return "data: {\"type\":\"start\"}\n\ndata: {\"type\":\"text-start\",\"id\":\"0\"}\n\n" +
+		fmt.Sprintf("data: %s\n\n", delta) +
+		"data: {\"type\":\"text-end\",\"id\":\"0\"}\n\ndata: {\"type\":\"finish-step\"}\n\ndata: {\"type\":\"finish\",\"finishReason\":\"stop\"}\n\ndata: [DONE]\n\n"
+}
+
+// TestTransformResponse_ToolChoiceRetry tests that a response missing the
+// required tool call is retried, and that each cookie is charged for its
+// own response
+func TestTransformResponse_ToolChoiceRetry(t *testing.T) {
+	responses := []string{
+		morphStream("I would read the file."),
+		morphStream("<function_calls>\n<invoke name=\"Read\">\n<parameter name=\"file_path\">/a</parameter>\n</invoke>\n</function_calls>"),
+	}
+	var requests []string
+	rotator := &stubRotator{cookies: []model.MorphCookie{{ID: 1}, {ID: 2}}}
+
+	previousTransport, previousRotator := http.DefaultTransport, types.CookieRotatorInstance
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		requests = append(requests, string(body))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(responses[len(requests)-1])),
+			Header:     http.Header{},
+			Request:    req,
+		}, nil
+	})
+	types.CookieRotatorInstance = rotator
+	t.Cleanup(func() {
+		http.DefaultTransport = previousTransport
+		types.CookieRotatorInstance = previousRotator
+	})
+
+	claudeReq := types.ClaudeRequest{
+		Model:      types.DefaultModel,
+		Messages:   []types.ClaudeMessage{{Role: "user", Content: "Read /a"}},
+		Tools:      []types.ClaudeTool{{Name: "Read", InputSchema: map[string]interface{}{"type": "object"}}},
+		ToolChoice: map[string]interface{}{"type": "any"},
+	}
+	var sessions []*upstreamSession
+	reopen := func(req types.ClaudeRequest) (*upstreamSession, error) {
+		session, err := openUpstreamSession(context.Background(), req, types.CookieSelector{}, "", "")
+		if err == nil {
+			sessions = append(sessions, session)
+		}
+		return session, err
+	}
+
+	session, err := reopen(claudeReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accumulator := stream.NewMessageAccumulator(claudeReq.Model, session.InputTokens)
+	if err := transformResponse(claudeReq, session, reopen, accumulator); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	message := accumulator.Message()
+	if message.StopReason != "tool_use" || len(message.Content) != 1 {
+		t.Fatalf("expected only the retried tool call, got %+v", message)
+	}
+	if len(requests) != 2 || !strings.Contains(requests[1], "I would read the file.") {
+		t.Fatalf("expected a retry carrying the first answer, got %d requests", len(requests))
+	}
+
+	// The first cookie is released before the retry takes the second
+	want := []string{"next 1", "release 1", "next 2", "release 2"}
+	if strings.Join(rotator.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("expected rotator calls %v, got %v", want, rotator.calls)
+	}
+	first, retry := sessions[0], sessions[1]
+	if output := first.usage.OutputTokens(); output == 0 || rotator.tokens[1] != first.InputTokens+output {
+		t.Errorf("expected cookie 1 charged for the discarded response, got %d", rotator.tokens[1])
+	}
+	if output := message.Usage["output_tokens"]; rotator.tokens[2] != retry.InputTokens+output {
+		t.Errorf("expected cookie 2 charged %d, got %d", retry.InputTokens+output, rotator.tokens[2])
+	}
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/types"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelResponse is an Anthropic-compatible model object
+type ModelResponse struct {
+	Type            string `json:"type"`
+	ID              string `json:"id"`
+	DisplayName     string `json:"display_name"`
+	CreatedAt       string `json:"created_at"`
+	ContextWindow   int    `json:"context_window,omitempty"`
+	MaxOutputTokens int    `json:"max_output_tokens,omitempty"`
+}
+
+// ModelListResponse is the response of GET /v1/models
+type ModelListResponse struct {
+	Data    []ModelResponse `json:"data"`
+	HasMore bool            `json:"has_more"`
+	FirstID *string         `json:"first_id"`
+	LastID  *string         `json:"last_id"`
+}
+
+// HandleListModels handles GET /v1/models
+// Supports the Anthropic pagination parameters limit, after_id and before_id
+func HandleListModels(c *gin.Context) {
+	models := types.Models.List()
+
+	start, end := 0, len(models)
+	if afterID := c.Query("after_id"); afterID != "" {
+		start = modelPosition(models, afterID) + 1
+	}
+	if beforeID := c.Query("before_id"); beforeID != "" {
+		if pos := modelPosition(models, beforeID); pos >= 0 {
+			end = pos
+		}
+	}
+	if start > end {
+		start = end
+	}
+
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			apierror.Write(c, apierror.InvalidRequest("limit must be between 1 and 1000"))
+			return
+		}
+		limit = parsed
+	}
+
+	page := models[start:end]
+	hasMore := false
+	if len(page) > limit {
+		if c.Query("before_id") != "" {
+			page = page[len(page)-limit:]
+		} else {
+			page = page[:limit]
+		}
+		hasMore = true
+	}
+
+	resp := ModelListResponse{
+		Data:    make([]ModelResponse, len(page)),
+		HasMore: hasMore,
+	}
+	for i, model := range page {
+		resp.Data[i] = toModelResponse(model)
+	}
+	if len(page) > 0 {
+		resp.FirstID = &page[0].ID
+		resp.LastID = &page[len(page)-1].ID
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleGetModel handles GET /v1/models/:id (accepts aliases)
+func HandleGetModel(c *gin.Context) {
+	model, ok := types.Models.Resolve(c.Param("id"))
+	if !ok {
+		apierror.Write(c, apierror.NotFound(fmt.Sprintf("model '%s' not found", c.Param("id"))))
+		return
+	}
+	c.JSON(http.StatusOK, toModelResponse(model))
+}
+
+// resolveRequestModel validates the requested model against the registry and
+// replaces aliases with the canonical model ID
+func resolveRequestModel(claudeReq *types.ClaudeRequest) *apierror.Error {
+	if claudeReq.Model == "" {
+		claudeReq.Model = types.DefaultModel
+	}
+	model, ok := types.Models.Resolve(claudeReq.Model)
+	if !ok {
+		return apierror.NotFound(fmt.Sprintf("Model '%s' is not supported. Supported models: %v", claudeReq.Model, types.Models.IDs()))
+	}
+	claudeReq.Model = model.ID
+	return nil
+}
+
+// modelPosition returns the position of a model in the list, or -1
+func modelPosition(models []types.ModelInfo, id string) int {
+	resolved, ok := types.Models.Resolve(id)
+	if !ok {
+		return -1
+	}
+	for i, model := range models {
+		if model.ID == resolved.ID {
+			return i
+		}
+	}
+	return -1
+}
+
+// toModelResponse converts a registry entry to the API format
+func toModelResponse(model types.ModelInfo) ModelResponse {
+	return ModelResponse{
+		Type:            "model",
+		ID:              model.ID,
+		DisplayName:     model.DisplayName,
+		CreatedAt:       model.CreatedAt,
+		ContextWindow:   model.ContextWindow,
+		MaxOutputTokens: model.MaxOutputTokens,
+	}
+}
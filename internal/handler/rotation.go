@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RotationHandler Cookie 轮询策略处理器
+type RotationHandler struct {
+	rotator *service.CookieRotator
+}
+
+// NewRotationHandler 创建轮询策略处理器
+func NewRotationHandler(rotator *service.CookieRotator) *RotationHandler {
+	return &RotationHandler{rotator: rotator}
+}
+
+// UpdateStrategyRequest 更新轮询策略请求
+type UpdateStrategyRequest struct {
+	Strategy string `json:"strategy" binding:"required"`
+}
+
+// StrategyResponse 轮询策略响应
+type StrategyResponse struct {
+	Strategy  service.RotationStrategy           `json:"strategy"`
+	Available []service.RotationStrategy         `json:"available"`
+	Health    map[uint]service.CookieHealthStats `json:"health"` // 按 Cookie ID，进程内统计
+}
+
+// GetStrategy 获取当前轮询策略
+func (h *RotationHandler) GetStrategy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.strategyResponse())
+}
+
+// UpdateStrategy 修改轮询策略（持久化）
+func (h *RotationHandler) UpdateStrategy(c *gin.Context) {
+	var req UpdateStrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	strategy, err := service.ParseStrategy(req.Strategy)
+	if err != nil {
+		apierror.Write(c, apierror.InvalidRequest(err.Error()))
+		return
+	}
+
+	if err := h.rotator.SaveStrategy(strategy); err != nil {
+		apierror.Write(c, apierror.Internal("failed to save rotation strategy"))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.strategyResponse())
+}
+
+func (h *RotationHandler) strategyResponse() StrategyResponse {
+	return StrategyResponse{
+		Strategy:  h.rotator.GetStrategy(),
+		Available: service.AvailableStrategies(),
+		Health:    h.rotator.Health().Snapshot(),
+	}
+}
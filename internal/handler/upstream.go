@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"opus-api/internal/apierror"
+	"opus-api/internal/logger"
+	"opus-api/internal/middleware"
+	"opus-api/internal/model"
+	"opus-api/internal/service"
+	"opus-api/internal/types"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamResponse is a successful (200) response from MorphLLM
+type upstreamResponse struct {
+	*http.Response
+	Cookie *model.MorphCookie
+	cancel context.CancelFunc
+}
+
+// Close releases the response body and its request context
+func (r *upstreamResponse) Close() {
+	r.Body.Close()
+	r.cancel()
+}
+
+// upstreamError is returned when every upstream attempt failed
+type upstreamError struct {
+	Attempts         int
+	CookiesTried     int
+	LastStatus       int // 0 if the last attempt got no response
+	LastErr          error
+	DeadlineExceeded bool
+}
+
+// APIError maps the failure to the error returned to the client
+func (e *upstreamError) APIError() *apierror.Error {
+	if e.DeadlineExceeded {
+		return apierror.New(http.StatusGatewayTimeout, apierror.TypeAPI, e.Error())
+	}
+	return apierror.FromUpstreamStatus(e.LastStatus, e.Error())
+}
+
+func (e *upstreamError) Error() string {
+	msg := fmt.Sprintf("upstream request failed after %d attempt(s) with %d cookie(s) tried", e.Attempts, e.CookiesTried)
+	if e.LastStatus != 0 {
+		msg += fmt.Sprintf(", last status: %d", e.LastStatus)
+	}
+	if e.LastErr != nil {
+		msg += fmt.Sprintf(", last error: %v", e.LastErr)
+	}
+	return msg
+}
+
+// sendUpstream posts the Morph request, failing over to the next rotated
+// cookie whenever the upstream rejects the cookie or fails (see
+// isCookieFault); other errors are returned on the first attempt. Nothing has been written to the
+// client at this point, so every retry is safe. Attempts are bounded by
+// types.UpstreamMaxAttempts and types.UpstreamRetryDeadline. A non-empty
+// cookieOverride is sent as is instead of a rotated cookie, without failover.
+func sendUpstream(ctx context.Context, selector types.CookieSelector, cookieOverride string, morphReqJSON []byte, logFolder string) (*upstreamResponse, error) {
+	deadline := time.Now().Add(types.UpstreamRetryDeadline)
+	maxAttempts := types.UpstreamMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	client := &http.Client{}
+	var triedIDs []uint
+	upErr := &upstreamError{}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 && time.Now().After(deadline) {
+			log.Printf("[WARN] Upstream retry deadline exceeded after %d attempt(s)", upErr.Attempts)
+			upErr.DeadlineExceeded = true
+			break
+		}
+
+		var (
+			cookie *model.MorphCookie
+			err    error
+		)
+		if cookieOverride == "" {
+			cookie, err = nextRotatedCookie(selector, triedIDs)
+		}
+		if errors.Is(err, service.ErrCookieLimitReached) && attempt == 1 {
+			// 有可用的 Cookie 但都达到了限流上限，不能退回到默认 Cookie
+			return nil, apierror.RateLimit("all cookies are at their rate limits, please retry later")
+		}
+		if err != nil && attempt > 1 {
+			// 没有更多可用的 Cookie
+			log.Printf("[WARN] No more cookies to fail over to: %v", err)
+			break
+		}
+
+		req, err := http.NewRequest("POST", types.MorphAPIURL, bytes.NewReader(morphReqJSON))
+		if err != nil {
+			releaseCookie(cookie, 0)
+			return nil, err
+		}
+		for key, value := range types.MorphHeaders {
+			req.Header.Set(key, value)
+		}
+		if cookieOverride != "" {
+			req.Header.Set("cookie", cookieOverride)
+		} else if cookie != nil {
+			req.Header.Set("cookie", cookie.APIKey)
+			triedIDs = append(triedIDs, cookie.ID)
+		}
+
+		// Log Point 3: Upstream request with headers
+		if types.DebugMode && logFolder != "" {
+			var reqLog strings.Builder
+			reqLog.WriteString(fmt.Sprintf("%s %s\n", req.Method, req.URL))
+			for k, v := range req.Header {
+				reqLog.WriteString(fmt.Sprintf("%s: %s\n", k, strings.Join(v, ", ")))
+			}
+			reqLog.WriteString("\n")
+			reqLog.Write(morphReqJSON)
+			logger.WriteTextLog(logFolder, fmt.Sprintf("3_upstream_request_attempt%d.txt", attempt), reqLog.String())
+		}
+
+		// The deadline only bounds the wait for response headers; once the
+		// upstream starts answering, the stream may run as long as it needs
+		attemptCtx, cancel := context.WithCancel(ctx)
+		timer := time.AfterFunc(time.Until(deadline), cancel)
+		start := time.Now()
+		resp, err := client.Do(req.WithContext(attemptCtx))
+		ttfb := time.Since(start)
+		timer.Stop()
+
+		upErr.Attempts = attempt
+		upErr.CookiesTried = len(triedIDs)
+
+		if err != nil {
+			cancel()
+			if ctx.Err() == nil {
+				recordCookieResult(cookie, 0, 0, err.Error())
+			}
+			releaseCookie(cookie, 0)
+			upErr.LastStatus = 0
+			upErr.LastErr = err
+			upErr.DeadlineExceeded = time.Now().After(deadline)
+			if types.DebugMode && logFolder != "" {
+				logger.WriteTextLog(logFolder, fmt.Sprintf("error_attempt%d.txt", attempt), fmt.Sprintf("Error: %v", err))
+			}
+			if ctx.Err() != nil || cookie == nil {
+				// 客户端已断开，或没有可切换的 Cookie
+				break
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			recordCookieResult(cookie, resp.StatusCode, ttfb, "")
+			return &upstreamResponse{Response: resp, Cookie: cookie, cancel: cancel}, nil
+		}
+
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if types.DebugMode && logFolder != "" {
+			logger.WriteTextLog(logFolder, fmt.Sprintf("error_attempt%d.txt", attempt), fmt.Sprintf("Error: %d %s\n%s", resp.StatusCode, resp.Status, string(bodyBytes)))
+		}
+		reason := fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(bodyBytes)))
+		if !isCookieFault(resp.StatusCode) {
+			// 请求本身有问题（400/404/413/422 等），换 Cookie 也不会成功，也不记为 Cookie 的错误
+			releaseCookie(cookie, 0)
+			return nil, apierror.FromUpstreamStatus(resp.StatusCode, "upstream rejected the request: "+reason)
+		}
+		recordCookieResult(cookie, resp.StatusCode, ttfb, reason)
+		releaseCookie(cookie, 0)
+		upErr.LastStatus = resp.StatusCode
+		upErr.LastErr = nil
+
+		if cookie == nil {
+			// 没有轮询器时无法切换 Cookie
+			break
+		}
+	}
+
+	return nil, upErr
+}
+
+// isCookieFault reports whether an upstream status may be caused by the
+// cookie rather than the request: a rejected cookie (401/403), an account
+// out of credit (402), rate limiting (429) or a server error. Only these
+// fail over to the next cookie and are recorded against it.
+func isCookieFault(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusPaymentRequired ||
+		statusCode == http.StatusForbidden || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// nextRotatedCookie returns the next cookie matching the selector that has
+// not been tried yet. It returns nil, nil when no rotator is configured.
+func nextRotatedCookie(selector types.CookieSelector, triedIDs []uint) (*model.MorphCookie, error) {
+	if types.CookieRotatorInstance == nil {
+		return nil, nil
+	}
+
+	selector.ExcludeIDs = triedIDs
+	cookieInterface, err := types.CookieRotatorInstance.NextCookie(selector)
+	if err != nil {
+		log.Printf("[WARN] Failed to get rotated cookie: %v, using default", err)
+		return nil, err
+	}
+
+	// 类型断言为 *model.MorphCookie
+	cookie, ok := cookieInterface.(*model.MorphCookie)
+	if !ok {
+		log.Printf("[WARN] Cookie type assertion failed, using default")
+		return nil, nil
+	}
+	log.Printf("[INFO] Using rotated cookie (ID: %d, Priority: %d)", cookie.ID, cookie.Priority)
+	return cookie, nil
+}
+
+// recordCookieResult records the outcome of an upstream call against the
+// rotated cookie. statusCode is 0 when the request never got a response;
+// ttfb is the time until the response headers arrived and reason describes
+// the failure. Only 401 invalidates the cookie at once; 402 and 403 may be
+// temporary, so the rotator invalidates the cookie after repeated ones.
+func recordCookieResult(cookie *model.MorphCookie, statusCode int, ttfb time.Duration, reason string) {
+	if cookie == nil || types.CookieRotatorInstance == nil {
+		return
+	}
+
+	var err error
+	switch {
+	case statusCode == http.StatusOK:
+		err = types.CookieRotatorInstance.MarkUsed(cookie.ID, ttfb)
+	case statusCode == http.StatusUnauthorized:
+		log.Printf("[WARN] Upstream rejected cookie (ID: %d) with %d, marking invalid", cookie.ID, statusCode)
+		err = types.CookieRotatorInstance.MarkInvalid(cookie.ID, reason)
+	default:
+		// 402/403 counts towards COOKIE_MAX_ERROR_COUNT, 429/5xx/network errors cool the cookie down
+		log.Printf("[WARN] Upstream call failed for cookie (ID: %d), status: %d", cookie.ID, statusCode)
+		err = types.CookieRotatorInstance.MarkError(cookie.ID, statusCode, reason)
+	}
+	if err != nil {
+		log.Printf("[WARN] Failed to record result for cookie (ID: %d): %v", cookie.ID, err)
+	}
+}
+
+// releaseCookie frees the rate limit slot the rotator reserved for the
+// cookie and charges the tokens used to its daily limit
+func releaseCookie(cookie *model.MorphCookie, tokens int) {
+	if cookie == nil || types.CookieRotatorInstance == nil {
+		return
+	}
+	types.CookieRotatorInstance.Release(cookie.ID, tokens)
+}
+
+// toAPIError converts an error from opening the upstream session
+func toAPIError(err error) *apierror.Error {
+	var upErr *upstreamError
+	if errors.As(err, &upErr) {
+		return upErr.APIError()
+	}
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return apierror.Internal(err.Error())
+}
+
+// cookieOverrideHeader carries an upstream cookie chosen by the client
+const cookieOverrideHeader = "x-morph-cookie"
+
+// cookieOverrideFor returns the upstream cookie the client asked for in
+// x-morph-cookie or, failing that, the raw Cookie header. Overrides are only
+// honoured for API keys with AllowCookieOverride: an explicit x-morph-cookie
+// from any other key is rejected, while a stray Cookie header is ignored.
+func cookieOverrideFor(c *gin.Context) (string, *apierror.Error) {
+	explicit := strings.TrimSpace(c.GetHeader(cookieOverrideHeader))
+	cookie := explicit
+	if cookie == "" {
+		cookie = strings.TrimSpace(c.GetHeader("Cookie"))
+	}
+	if cookie == "" {
+		return "", nil
+	}
+
+	key, _ := middleware.GetAPIKey(c)
+	if key == nil || !key.AllowCookieOverride {
+		if explicit != "" {
+			return "", apierror.Permission("this API key is not allowed to override the upstream cookie")
+		}
+		return "", nil
+	}
+
+	log.Printf("[INFO] Using client cookie override from API key %s (ID: %d, user: %d), bypassing rotation", key.KeyPrefix, key.ID, key.UserID)
+	return cookie, nil
+}
+
+// cookiePoolHeader restricts a request to one named cookie pool, which must
+// be shared or belong to the caller
+const cookiePoolHeader = "x-cookie-pool"
+
+// sessionIDHeader names the conversation a request belongs to, so the
+// rotator keeps the conversation on the same cookie
+const sessionIDHeader = "x-session-id"
+
+// cookieSelectorFor builds the rotator selector for the authenticated
+// request: the pool picked by cookiePoolFor if any, otherwise the caller's
+// own cookies first, then the shared pools
+func cookieSelectorFor(c *gin.Context, claudeReq types.ClaudeRequest) types.CookieSelector {
+	var selector types.CookieSelector
+	if userID, ok := middleware.GetUserID(c); ok {
+		selector.UserID = userID
+	}
+	key, _ := middleware.GetAPIKey(c)
+	selector.Pool = cookiePoolFor(c, key, claudeReq.Model)
+	selector.PoolBound = key != nil && key.CookiePool != ""
+	if key != nil && key.OwnCookiesOnly {
+		selector.Scope = types.PoolScopeUser
+	} else if selector.Pool != "" {
+		selector.Scope = types.PoolScopeGroup
+	}
+	selector.AffinityKey = affinityKeyFor(c, claudeReq)
+	return selector
+}
+
+// affinityKeyFor identifies the conversation of a request: the session
+// header if present, then metadata.user_id, then a hash of the text of the
+// first user message, which stays the same for every turn of a conversation.
+// Empty means the request has no affinity.
+func affinityKeyFor(c *gin.Context, claudeReq types.ClaudeRequest) string {
+	if sessionID := strings.TrimSpace(c.GetHeader(sessionIDHeader)); sessionID != "" {
+		return "session:" + sessionID
+	}
+	if userID, ok := claudeReq.Metadata["user_id"].(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	for _, msg := range claudeReq.Messages {
+		if msg.Role != "user" {
+			continue
+		}
+		text := messageText(msg.Content)
+		if text == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(text))
+		return "message:" + hex.EncodeToString(sum[:16])
+	}
+	return ""
+}
+
+// messageText concatenates the text blocks of a message content. Other
+// fields such as cache_control are ignored because clients move them
+// between turns.
+func messageText(content interface{}) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		var text strings.Builder
+		for _, block := range content {
+			if b, ok := block.(map[string]interface{}); ok && b["type"] == "text" {
+				if t, ok := b["text"].(string); ok {
+					text.WriteString(t)
+				}
+			}
+		}
+		return text.String()
+	case []types.ClaudeContentBlock:
+		var text strings.Builder
+		for _, block := range content {
+			if b, ok := block.(types.ClaudeContentBlockText); ok {
+				text.WriteString(b.Text)
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+// cookiePoolFor resolves the cookie pool of a request. A pool bound to the
+// API key always wins so the header cannot escape it; otherwise the header,
+// then the model's configured pool. Empty means the rotator's default pool.
+func cookiePoolFor(c *gin.Context, key *model.APIKey, modelID string) string {
+	if key != nil && key.CookiePool != "" {
+		return key.CookiePool
+	}
+	if pool := strings.TrimSpace(c.GetHeader(cookiePoolHeader)); pool != "" {
+		return pool
+	}
+	if info, ok := types.Models.Resolve(modelID); ok {
+		return info.CookiePool
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"opus-api/internal/apierror"
+	"opus-api/internal/model"
+	"opus-api/internal/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubRotator hands out its cookies round robin and records what happens
+// to them. When maxErrors is set a cookie is invalidated, and no longer
+// handed out, once MarkError has been called that many times for it
+type stubRotator struct {
+	cookies     []model.MorphCookie
+	next        int
+	errors      []int // statuses passed to MarkError
+	invalid     []uint
+	used        []uint
+	released    int
+	tokens      map[uint]int // tokens passed to Release per cookie
+	calls       []string     // "next <id>" and "release <id>" in call order
+	maxErrors   int
+	errorCounts map[uint]int
+}
+
+func (r *stubRotator) NextCookie(selector types.CookieSelector) (interface{}, error) {
+	for i := range r.cookies {
+		cookie := &r.cookies[(r.next+i)%len(r.cookies)]
+		excluded := false
+		for _, id := range append(selector.ExcludeIDs, r.invalid...) {
+			excluded = excluded || id == cookie.ID
+		}
+		if !excluded {
+			r.next = (r.next + i + 1) % len(r.cookies)
+			r.calls = append(r.calls, fmt.Sprintf("next %d", cookie.ID))
+			return cookie, nil
+		}
+	}
+	return nil, errors.New("no cookies left")
+}
+
+func (r *stubRotator) MarkUsed(cookieID uint, ttfb time.Duration) error {
+	r.used = append(r.used, cookieID)
+	return nil
+}
+
+func (r *stubRotator) MarkError(cookieID uint, statusCode int, reason string) error {
+	r.errors = append(r.errors, statusCode)
+	if r.errorCounts == nil {
+		r.errorCounts = make(map[uint]int)
+	}
+	r.errorCounts[cookieID]++
+	if r.maxErrors > 0 && r.errorCounts[cookieID] == r.maxErrors {
+		r.invalid = append(r.invalid, cookieID)
+	}
+	return nil
+}
+
+func (r *stubRotator) MarkInvalid(cookieID uint, reason string) error {
+	r.invalid = append(r.invalid, cookieID)
+	return nil
+}
+
+func (r *stubRotator) Release(cookieID uint, tokens int) {
+	r.released++
+	if r.tokens == nil {
+		r.tokens = make(map[uint]int)
+	}
+	r.tokens[cookieID] += tokens
+	r.calls = append(r.calls, fmt.Sprintf("release %d", cookieID))
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// withUpstream answers every upstream request with the given status and
+// installs a rotator with three cookies; it returns the rotator and a
+// pointer to the number of upstream requests made
+func withUpstream(t *testing.T, status int) (*stubRotator, *int) {
+	rotator := &stubRotator{cookies: []model.MorphCookie{{ID: 1}, {ID: 2}, {ID: 3}}}
+	requests := 0
+
+	previousTransport, previousRotator := http.DefaultTransport, types.CookieRotatorInstance
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Body:       io.NopCloser(strings.NewReader(`{"error":"bad"}`)),
+			Header:     http.Header{},
+			Request:    req,
+		}, nil
+	})
+	types.CookieRotatorInstance = rotator
+	t.Cleanup(func() {
+		http.DefaultTransport = previousTransport
+		types.CookieRotatorInstance = previousRotator
+	})
+	return rotator, &requests
+}
+
+func TestSendUpstream_RequestErrorDoesNotFailOver(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity} {
+		rotator, requests := withUpstream(t, status)
+
+		_, err := sendUpstream(context.Background(), types.CookieSelector{}, "", []byte("{}"), "")
+
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Status != apierror.FromUpstreamStatus(status, "").Status {
+			t.Errorf("%d: expected the upstream error mapped through apierror, got %v", status, err)
+		}
+		if *requests != 1 {
+			t.Errorf("%d: expected no failover, got %d upstream requests", status, *requests)
+		}
+		if len(rotator.errors) != 0 || len(rotator.invalid) != 0 {
+			t.Errorf("%d: expected the cookie to be left alone, got errors %v, invalid %v", status, rotator.errors, rotator.invalid)
+		}
+		if rotator.released != 1 {
+			t.Errorf("%d: expected the cookie to be released once, got %d", status, rotator.released)
+		}
+	}
+}
+
+func TestSendUpstream_CookieFaultFailsOver(t *testing.T) {
+	for _, status := range []int{http.StatusPaymentRequired, http.StatusServiceUnavailable} {
+		rotator, requests := withUpstream(t, status)
+
+		_, err := sendUpstream(context.Background(), types.CookieSelector{}, "", []byte("{}"), "")
+
+		var upErr *upstreamError
+		if !errors.As(err, &upErr) || upErr.LastStatus != status {
+			t.Errorf("%d: expected an upstreamError, got %v", status, err)
+		}
+		if *requests != types.UpstreamMaxAttempts {
+			t.Errorf("%d: expected %d attempts, got %d", status, types.UpstreamMaxAttempts, *requests)
+		}
+		if len(rotator.errors) != *requests {
+			t.Errorf("%d: expected every failed cookie to be recorded, got %v", status, rotator.errors)
+		}
+	}
+}
+
+func TestSendUpstream_AccountErrorsInvalidateCookie(t *testing.T) {
+	rotator, requests := withUpstream(t, http.StatusForbidden)
+	rotator.cookies = rotator.cookies[:1]
+	rotator.maxErrors = 3
+
+	// Each request fails on the only cookie and counts towards its threshold
+	for i := 1; i <= rotator.maxErrors; i++ {
+		if _, err := sendUpstream(context.Background(), types.CookieSelector{}, "", []byte("{}"), ""); err == nil {
+			t.Fatalf("request %d: expected an error", i)
+		}
+		if *requests != i {
+			t.Fatalf("request %d: expected %d upstream requests, got %d", i, i, *requests)
+		}
+	}
+	if len(rotator.invalid) != 1 || rotator.invalid[0] != 1 {
+		t.Fatalf("expected the cookie invalidated after %d errors, got %v", rotator.maxErrors, rotator.invalid)
+	}
+
+	// The invalidated cookie is no longer handed out
+	calls := len(rotator.calls)
+	sendUpstream(context.Background(), types.CookieSelector{}, "", []byte("{}"), "")
+	for _, call := range rotator.calls[calls:] {
+		if call == "next 1" {
+			t.Errorf("expected the invalidated cookie to be skipped, got calls %v", rotator.calls[calls:])
+		}
+	}
+	if len(rotator.errors) != rotator.maxErrors {
+		t.Errorf("expected no further errors recorded, got %v", rotator.errors)
+	}
+}
+
+func TestCookieSelectorFor_Pool(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		header    string
+		key       *model.APIKey
+		wantScope types.PoolScope
+		wantPool  string
+	}{
+		{"", nil, types.PoolScopeDefault, ""},
+		{" team ", nil, types.PoolScopeGroup, "team"},
+		// A key limited to its own cookies only narrows them down to the pool
+		{"team", &model.APIKey{OwnCookiesOnly: true}, types.PoolScopeUser, "team"},
+		// A pool bound to the key cannot be switched by the header
+		{"team", &model.APIKey{CookiePool: "production"}, types.PoolScopeGroup, "production"},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		c.Request.Header.Set(cookiePoolHeader, tt.header)
+		c.Set("user_id", uint(7))
+		if tt.key != nil {
+			c.Set("api_key", tt.key)
+		}
+
+		selector := cookieSelectorFor(c, types.ClaudeRequest{})
+		if selector.Scope != tt.wantScope || selector.Pool != tt.wantPool || selector.UserID != 7 {
+			t.Errorf("header %q, key %+v: got scope %q, pool %q, user %d", tt.header, tt.key, selector.Scope, selector.Pool, selector.UserID)
+		}
+		if bound := tt.key != nil && tt.key.CookiePool != ""; selector.PoolBound != bound {
+			t.Errorf("header %q, key %+v: PoolBound = %v, want %v", tt.header, tt.key, selector.PoolBound, bound)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"opus-api/internal/apierror"
+	"opus-api/internal/model"
+	"opus-api/internal/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyMiddleware /v1 接口的 API Key 认证中间件
+// 支持 x-api-key 请求头或 Authorization: Bearer
+func APIKeyMiddleware(apiKeyService *service.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := extractAPIKey(c)
+		if rawKey == "" {
+			apierror.Abort(c, apierror.Authentication("missing api key, use the x-api-key header or Authorization: Bearer"))
+			return
+		}
+
+		key, err := apiKeyService.ValidateKey(rawKey)
+		if err != nil {
+			if !errors.Is(err, service.ErrInvalidAPIKey) {
+				log.Printf("[ERROR] Failed to validate api key: %v", err)
+				apierror.Abort(c, apierror.Internal("failed to validate api key"))
+				return
+			}
+			apierror.Abort(c, apierror.Authentication("invalid api key"))
+			return
+		}
+
+		log.Printf("[INFO] Request from user %d via api key %s (%s)", key.UserID, key.KeyPrefix, key.Name)
+
+		// 将用户 ID 和 API Key 存储到上下文
+		c.Set("user_id", key.UserID)
+		c.Set("api_key", key)
+		c.Next()
+	}
+}
+
+// extractAPIKey 从 x-api-key 或 Authorization 请求头读取 API Key
+func extractAPIKey(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("x-api-key")); key != "" {
+		return key
+	}
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
+
+// GetAPIKey 从上下文获取当前请求的 API Key
+func GetAPIKey(c *gin.Context) (*model.APIKey, bool) {
+	value, exists := c.Get("api_key")
+	if !exists {
+		return nil, false
+	}
+	key, ok := value.(*model.APIKey)
+	return key, ok
+}
@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"net/http"
+	"opus-api/internal/apierror"
 	"opus-api/internal/service"
 	"strings"
 
@@ -13,16 +13,14 @@ func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
-			c.Abort()
+			apierror.Abort(c, apierror.Authentication("missing authorization header"))
 			return
 		}
 
 		// 解析 Bearer token
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
+			apierror.Abort(c, apierror.Authentication("invalid authorization header format"))
 			return
 		}
 
@@ -31,8 +29,7 @@ func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 		// 验证 token
 		userID, err := authService.ValidateToken(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
+			apierror.Abort(c, apierror.Authentication("invalid or expired token"))
 			return
 		}
 
@@ -42,6 +39,19 @@ func AuthMiddleware(authService *service.AuthService) gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware 只允许管理员访问，需要在 AuthMiddleware 之后使用
+func AdminMiddleware(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := GetUserID(c)
+		user, err := authService.GetUserByID(userID)
+		if err != nil || !user.IsAdmin {
+			apierror.Abort(c, apierror.Permission("administrator privileges required"))
+			return
+		}
+		c.Next()
+	}
+}
+
 // GetUserID 从上下文获取用户 ID
 func GetUserID(c *gin.Context) (uint, bool) {
 	userID, exists := c.Get("user_id")
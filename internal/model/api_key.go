@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// APIKey 调用 /v1 接口使用的 API Key（只保存哈希值）
+type APIKey struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	UserID              uint       `gorm:"not null;index" json:"user_id"`
+	User                User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Name                string     `gorm:"size:100;not null" json:"name"`
+	KeyHash             string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	KeyPrefix           string     `gorm:"size:32;not null" json:"key_prefix"`            // 明文前缀，用于在列表中识别
+	OwnCookiesOnly      bool       `gorm:"default:false" json:"own_cookies_only"`         // 只使用所属用户的 Cookie
+	CookiePool          string     `gorm:"column:cookie_pool;size:50" json:"cookie_pool"` // 绑定的 Cookie 池，为空时不限制
+	AllowCookieOverride bool       `gorm:"default:false" json:"allow_cookie_override"`    // 允许通过请求头指定上游 Cookie，绕过轮询
+	UsageCount          int64      `gorm:"default:0" json:"usage_count"`
+	LastUsed            *time.Time `gorm:"column:last_used" json:"last_used"`
+	RevokedAt           *time.Time `gorm:"column:revoked_at;index" json:"revoked_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsRevoked 是否已吊销
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
@@ -1,25 +1,57 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // MorphCookie Morph Cookie 模型
 type MorphCookie struct {
-	ID            uint       `gorm:"primaryKey" json:"id"`
-	UserID        uint       `gorm:"not null;index" json:"user_id"`
-	User          User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
-	Name          string     `gorm:"size:100;not null" json:"name"`
-	APIKey        string     `gorm:"column:api_key;type:text;not null" json:"api_key"`
-	SessionKey    string     `gorm:"column:session_key;type:text" json:"session_key"`
-	IsValid       bool       `gorm:"default:true;index" json:"is_valid"`
-	LastValidated *time.Time `gorm:"column:last_validated" json:"last_validated"`
-	LastUsed      *time.Time `gorm:"column:last_used" json:"last_used"`
-	Priority      int        `gorm:"default:0;index" json:"priority"`
-	UsageCount    int64      `gorm:"default:0" json:"usage_count"`
-	ErrorCount    int        `gorm:"default:0" json:"error_count"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"not null;index" json:"user_id"`
+	User            User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Name            string     `gorm:"size:100;not null" json:"name"`
+	Pool            string     `gorm:"size:50;not null;default:default;index" json:"pool"`
+	APIKey          string     `gorm:"column:api_key;type:text;not null;serializer:secret" json:"api_key"` // 配置主密钥后加密保存
+	KeyHash         string     `gorm:"column:key_hash;size:64;index" json:"-"`                             // APIKey 的 SHA-256，用于去重
+	SessionKey      string     `gorm:"column:session_key;type:text;serializer:secret" json:"session_key"`
+	IsValid         bool       `gorm:"default:true;index" json:"is_valid"`
+	LastValidated   *time.Time `gorm:"column:last_validated" json:"last_validated"`
+	LastUsed        *time.Time `gorm:"column:last_used" json:"last_used"`
+	Priority        int        `gorm:"default:0;index" json:"priority"`
+	RPMLimit        int        `gorm:"column:rpm_limit;default:0" json:"rpm_limit"`                 // 每分钟请求数上限，0 表示不限制
+	DailyTokenLimit int64      `gorm:"column:daily_token_limit;default:0" json:"daily_token_limit"` // 每日 Token 上限（输入加输出），0 表示不限制
+	MaxConcurrent   int        `gorm:"column:max_concurrent;default:0" json:"max_concurrent"`       // 最大并发流数，0 表示不限制
+	UsageCount      int64      `gorm:"default:0" json:"usage_count"`
+	ErrorCount      int        `gorm:"default:0" json:"error_count"`
+	CooldownUntil   *time.Time `gorm:"column:cooldown_until;index" json:"cooldown_until"` // 冷却结束时间，之前不参与轮询
+	CooldownCount   int        `gorm:"default:0" json:"cooldown_count"`                   // 连续冷却次数，用于指数退避
+	LastError       string     `gorm:"column:last_error;size:255" json:"last_error"`
+	LastErrorAt     *time.Time `gorm:"column:last_error_at" json:"last_error_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// DefaultPool 默认 Cookie 池名称
+const DefaultPool = "default"
+
+// CookiePool Cookie 池设置，Shared 为 true 时池中的 Cookie 对所有用户可用
+type CookiePool struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Shared    bool      `gorm:"default:false" json:"shared"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CookiePool) TableName() string {
+	return "cookie_pools"
 }
 
 // CookieStats Cookie 统计信息
@@ -27,6 +59,7 @@ type CookieStats struct {
 	TotalCount   int64 `json:"total_count"`
 	ValidCount   int64 `json:"valid_count"`
 	InvalidCount int64 `json:"invalid_count"`
+	CoolingCount int64 `json:"cooling_count"` // 有效但冷却中
 	TotalUsage   int64 `json:"total_usage"`
 }
 
@@ -41,6 +74,8 @@ func (c *MorphCookie) MarkUsed() {
 	c.LastUsed = &now
 	c.UsageCount++
 	c.ErrorCount = 0 // 成功使用后重置错误计数
+	c.CooldownUntil = nil
+	c.CooldownCount = 0
 }
 
 // MarkError 标记 Cookie 错误
@@ -48,6 +83,11 @@ func (c *MorphCookie) MarkError() {
 	c.ErrorCount++
 }
 
+// IsCoolingDown 是否处于冷却中
+func (c *MorphCookie) IsCoolingDown() bool {
+	return c.CooldownUntil != nil && c.CooldownUntil.After(time.Now())
+}
+
 // MarkInvalid 标记 Cookie 无效
 func (c *MorphCookie) MarkInvalid() {
 	c.IsValid = false
@@ -59,6 +99,69 @@ func (c *MorphCookie) MarkInvalid() {
 func (c *MorphCookie) MarkValid() {
 	c.IsValid = true
 	c.ErrorCount = 0
+	c.CooldownUntil = nil
+	c.CooldownCount = 0
 	now := time.Now()
 	c.LastValidated = &now
-}
\ No newline at end of file
+}
+
+// LegacySharedPool 升级前已有的 Cookie 迁移到的共享池
+const LegacySharedPool = "legacy-shared"
+
+// legacyPoolMigratedKey 记录已完成旧 Cookie 迁移的设置键
+const legacyPoolMigratedKey = "cookie_pools.legacy_migrated"
+
+// MigrateLegacySharedPool 保持升级前已有的 Cookie 对所有用户可用：把默认池中已有的 Cookie 一次性移到共享的
+// legacy-shared 池，并取消默认池的共享。之后新建的 Cookie 和池默认都是私有的。只执行一次
+func MigrateLegacySharedPool(db *gorm.DB) error {
+	if _, done, err := GetSetting(db, legacyPoolMigratedKey); err != nil || done {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&MorphCookie{}).Where("pool = ?", DefaultPool).Update("pool", LegacySharedPool)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			pool := CookiePool{Name: LegacySharedPool}
+			if err := tx.Where("name = ?", LegacySharedPool).FirstOrCreate(&pool).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&pool).Update("shared", true).Error; err != nil {
+				return err
+			}
+			log.Printf("Moved %d existing cookie(s) to the shared pool '%s'", result.RowsAffected, LegacySharedPool)
+		}
+
+		if err := tx.Model(&CookiePool{}).Where("name = ?", DefaultPool).Update("shared", false).Error; err != nil {
+			return err
+		}
+		return SaveSetting(tx, legacyPoolMigratedKey, time.Now().Format(time.RFC3339))
+	})
+}
+
+// HashCookieKey 计算 Cookie 的哈希值，忽略首尾空白
+func HashCookieKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(apiKey)))
+	return hex.EncodeToString(sum[:])
+}
+
+// BackfillCookieKeyHashes 为升级前创建的 Cookie 计算 KeyHash
+func BackfillCookieKeyHashes(db *gorm.DB) error {
+	var cookies []MorphCookie
+	if err := db.Where("key_hash IS NULL OR key_hash = ''").Find(&cookies).Error; err != nil {
+		return err
+	}
+
+	for _, cookie := range cookies {
+		if err := db.Model(&cookie).Update("key_hash", HashCookieKey(cookie.APIKey)).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(cookies) > 0 {
+		log.Printf("Computed key hashes for %d cookie(s)", len(cookies))
+	}
+	return nil
+}
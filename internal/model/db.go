@@ -56,6 +56,10 @@ func autoMigrate() error {
 		&User{},
 		&MorphCookie{},
 		&UserSession{},
+		&APIKey{},
+		&CookiePool{},
+		&Setting{},
+		&CookieValidation{},
 	)
 }
 
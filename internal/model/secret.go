@@ -0,0 +1,101 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"opus-api/internal/secret"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// keyring 加密敏感字段使用的密钥环，为 nil 时以明文保存
+var keyring *secret.Keyring
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// SetKeyring 设置加密密钥环，需要在读写数据库之前调用
+func SetKeyring(k *secret.Keyring) {
+	keyring = k
+}
+
+// SecretSerializer 在写入数据库时加密字符串字段，读取时解密（gorm 标签 serializer:secret）
+type SecretSerializer struct{}
+
+// Scan 解密数据库中的值
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("unsupported secret value type %T", dbValue)
+	}
+
+	plaintext, err := keyring.Decrypt(value)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", field.DBName, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value 加密字段值，空字符串不加密
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	if value == "" || keyring == nil {
+		return value, nil
+	}
+	return keyring.Encrypt(value)
+}
+
+// EncryptCookieSecrets 用当前主密钥加密明文保存的 Cookie 密钥，并重新加密使用历史主密钥的数据
+func EncryptCookieSecrets(db *gorm.DB) error {
+	if keyring == nil {
+		return nil
+	}
+
+	// 直接读取原始列，绕过 serializer
+	var rows []struct {
+		ID         uint
+		APIKey     string
+		SessionKey string
+	}
+	if err := db.Table("morph_cookies").Select("id, api_key, session_key").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, row := range rows {
+		updates := map[string]interface{}{}
+		for column, value := range map[string]string{"api_key": row.APIKey, "session_key": row.SessionKey} {
+			if value == "" || !keyring.NeedsRewrap(value) {
+				continue
+			}
+			rewrapped, err := keyring.Rewrap(value)
+			if err != nil {
+				return fmt.Errorf("cookie %d %s: %w", row.ID, column, err)
+			}
+			updates[column] = rewrapped
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		if err := db.Table("morph_cookies").Where("id = ?", row.ID).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		updated++
+	}
+
+	if updated > 0 {
+		log.Printf("Encrypted secrets of %d cookie(s) with the current key", updated)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Setting 运行时设置（键值对），用于在重启后保留通过接口修改的配置
+type Setting struct {
+	Key       string    `gorm:"primaryKey;size:100" json:"key"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Setting) TableName() string {
+	return "settings"
+}
+
+// GetSetting 读取设置，不存在时返回 ok=false
+func GetSetting(db *gorm.DB, key string) (value string, ok bool, err error) {
+	var setting Setting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return setting.Value, true, nil
+}
+
+// SaveSetting 保存设置（存在则覆盖）
+func SaveSetting(db *gorm.DB, key, value string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&Setting{Key: key, Value: value}).Error
+}
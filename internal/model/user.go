@@ -14,6 +14,7 @@ type User struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	Username     string    `gorm:"uniqueIndex;size:50;not null" json:"username"`
 	PasswordHash string    `gorm:"size:255;not null" json:"-"`
+	IsAdmin      bool      `gorm:"not null;default:false" json:"is_admin"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -70,14 +71,18 @@ func CreateDefaultAdmin(db *gorm.DB) error {
 	var existingUser User
 	result := db.Where("username = ?", username).First(&existingUser)
 	if result.Error == nil {
-		// 用户已存在
+		// 用户已存在，升级前创建的默认管理员在这里获得管理员权限
 		log.Printf("Default admin user '%s' already exists", username)
+		if !existingUser.IsAdmin {
+			return db.Model(&existingUser).Update("is_admin", true).Error
+		}
 		return nil
 	}
 
 	// 创建新用户
 	user := &User{
 		Username: username,
+		IsAdmin:  true,
 	}
 	if err := user.SetPassword(password); err != nil {
 		return err
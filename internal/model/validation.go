@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+)
+
+// 验证来源
+const (
+	ValidationSourceManual    = "manual"    // 管理界面手动验证
+	ValidationSourceScheduled = "scheduled" // 后台定时健康检查
+)
+
+// CookieValidation Cookie 验证历史记录
+type CookieValidation struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	CookieID   uint        `gorm:"not null;index" json:"cookie_id"`
+	Cookie     MorphCookie `gorm:"foreignKey:CookieID;constraint:OnDelete:CASCADE" json:"-"`
+	Source     string      `gorm:"size:20;not null" json:"source"`
+	IsValid    bool        `json:"is_valid"`
+	StatusCode int         `json:"status_code"` // 0 表示没有收到响应
+	LatencyMs  int64       `json:"latency_ms"`
+	Error      string      `gorm:"size:500" json:"error"` // 错误信息或响应片段
+	CreatedAt  time.Time   `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (CookieValidation) TableName() string {
+	return "cookie_validations"
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"opus-api/internal/types"
+	"reflect"
+	"strings"
+)
+
+// ToolSchemas 请求中声明的工具的 input_schema，按工具名称索引
+type ToolSchemas map[string]map[string]interface{}
+
+// NewToolSchemas 从请求的工具定义创建 ToolSchemas
+func NewToolSchemas(tools []types.ClaudeTool) ToolSchemas {
+	schemas := make(ToolSchemas, len(tools))
+	for _, tool := range tools {
+		schema := tool.InputSchema
+		if schema == nil {
+			schema = map[string]interface{}{}
+		}
+		schemas[tool.Name] = schema
+	}
+	return schemas
+}
+
+// Has 工具是否在请求中声明
+func (s ToolSchemas) Has(tool string) bool {
+	_, ok := s[tool]
+	return ok
+}
+
+// Property 参数的 schema，工具或参数未声明时返回 nil
+func (s ToolSchemas) Property(tool, param string) map[string]interface{} {
+	properties, _ := s[tool]["properties"].(map[string]interface{})
+	property, _ := properties[param].(map[string]interface{})
+	return property
+}
+
+// MissingRequired 返回 input 中缺少的必填参数
+func (s ToolSchemas) MissingRequired(tool string, input map[string]interface{}) []string {
+	required, _ := s[tool]["required"].([]interface{})
+	var missing []string
+	for _, name := range required {
+		if name, ok := name.(string); ok {
+			if _, present := input[name]; !present {
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing
+}
+
+// Problems 校验工具调用，返回工具未声明、参数值无效和缺少必填参数等问题，
+// paramErrors 为转换参数值时产生的错误
+func (s ToolSchemas) Problems(toolCall types.ParsedToolCall, paramErrors []string) []string {
+	if !s.Has(toolCall.Name) {
+		return []string{fmt.Sprintf("unknown tool '%s'", toolCall.Name)}
+	}
+	problems := append([]string{}, paramErrors...)
+	for _, name := range s.MissingRequired(toolCall.Name, toolCall.Input) {
+		problems = append(problems, fmt.Sprintf("missing required parameter '%s'", name))
+	}
+	return problems
+}
+
+// SchemaTypes 参数 schema 允许的类型，支持 type 为字符串或数组，以及 anyOf/oneOf 中的类型
+func SchemaTypes(property map[string]interface{}) []string {
+	var result []string
+	switch t := property["type"].(type) {
+	case string:
+		result = append(result, t)
+	case []interface{}:
+		for _, item := range t {
+			if item, ok := item.(string); ok {
+				result = append(result, item)
+			}
+		}
+	}
+	if len(result) == 0 {
+		for _, key := range []string{"anyOf", "oneOf"} {
+			variants, _ := property[key].([]interface{})
+			for _, variant := range variants {
+				if variant, ok := variant.(map[string]interface{}); ok {
+					result = append(result, SchemaTypes(variant)...)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// IsStringOnly 参数是否只能是字符串（不需要解析，可以直接流式输出）
+func IsStringOnly(property map[string]interface{}) bool {
+	allowed := SchemaTypes(property)
+	return len(allowed) == 1 && allowed[0] == "string"
+}
+
+// CoerceParamValue 按参数的 schema 转换参数值：字符串保持原样，数字、布尔值、数组和对象按 JSON 解析，
+// 并检查枚举值。没有 schema 或 schema 没有指定类型时按 ParseParamValue 推断类型。
+// 无法转换或不在枚举值中时返回去掉首尾空白的字符串和错误
+func CoerceParamValue(property map[string]interface{}, value string) (interface{}, error) {
+	trimmedValue := strings.TrimSpace(value)
+	if property == nil {
+		return ParseParamValue(trimmedValue), nil
+	}
+
+	var result interface{}
+	allowed := SchemaTypes(property)
+	if len(allowed) == 0 {
+		result = ParseParamValue(trimmedValue)
+	} else {
+		var ok bool
+		result, ok = coerceToTypes(allowed, trimmedValue)
+		if !ok {
+			return trimmedValue, fmt.Errorf("expected %s", strings.Join(allowed, " or "))
+		}
+	}
+
+	if enum, ok := property["enum"].([]interface{}); ok && len(enum) > 0 {
+		for _, option := range enum {
+			if reflect.DeepEqual(option, result) {
+				return result, nil
+			}
+		}
+		options := make([]string, len(enum))
+		for i, option := range enum {
+			options[i] = fmt.Sprint(option)
+		}
+		return trimmedValue, fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+	}
+	return result, nil
+}
+
+// coerceToTypes 按顺序尝试转换为允许的类型，string 作为最后的选择
+func coerceToTypes(allowed []string, value string) (interface{}, bool) {
+	allowString := false
+	for _, t := range allowed {
+		if t == "string" {
+			allowString = true
+			continue
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			continue
+		}
+		if matchesType(t, parsed) {
+			return parsed, true
+		}
+	}
+	if allowString {
+		return value, true
+	}
+	return nil, false
+}
+
+// matchesType JSON 值是否符合 schema 类型
+func matchesType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"opus-api/internal/types"
+	"reflect"
+	"testing"
+)
+
+func TestCoerceParamValue(t *testing.T) {
+	// 测试按 schema 类型转换参数值及枚举检查
+	cases := []struct {
+		property map[string]interface{}
+		value    string
+		expected interface{}
+		wantErr  bool
+	}{
+		{map[string]interface{}{"type": "string"}, " 42 ", "42", false},
+		{map[string]interface{}{"type": "string"}, `{"a": 1}`, `{"a": 1}`, false},
+		{map[string]interface{}{"type": "integer"}, "42", float64(42), false},
+		{map[string]interface{}{"type": "integer"}, "4.2", "4.2", true},
+		{map[string]interface{}{"type": "number"}, "4.2", 4.2, false},
+		{map[string]interface{}{"type": "boolean"}, "true", true, false},
+		{map[string]interface{}{"type": "boolean"}, "yes", "yes", true},
+		{map[string]interface{}{"type": "array"}, `["a", "b"]`, []interface{}{"a", "b"}, false},
+		{map[string]interface{}{"type": "object"}, `[1]`, "[1]", true},
+		{map[string]interface{}{"type": []interface{}{"integer", "string"}}, "abc", "abc", false},
+		{map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "number"}, map[string]interface{}{"type": "null"}}}, "null", nil, false},
+		{map[string]interface{}{"type": "string", "enum": []interface{}{"pending", "completed"}}, "completed", "completed", false},
+		{map[string]interface{}{"type": "string", "enum": []interface{}{"pending", "completed"}}, "done", "done", true},
+		{map[string]interface{}{"enum": []interface{}{float64(1), float64(2)}}, "2", float64(2), false},
+		{nil, "12", float64(12), false},
+		{nil, "hello", "hello", false},
+	}
+
+	for _, c := range cases {
+		value, err := CoerceParamValue(c.property, c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%v %q: unexpected error %v", c.property, c.value, err)
+		}
+		if !reflect.DeepEqual(value, c.expected) {
+			t.Errorf("%v %q: expected %#v, got %#v", c.property, c.value, c.expected, value)
+		}
+	}
+}
+
+func TestToolSchemasProblems(t *testing.T) {
+	// 测试未声明的工具和缺少必填参数
+	schemas := NewToolSchemas([]types.ClaudeTool{{
+		Name: "Read",
+		InputSchema: map[string]interface{}{
+			"properties": map[string]interface{}{"file_path": map[string]interface{}{"type": "string"}},
+			"required":   []interface{}{"file_path"},
+		},
+	}})
+
+	if problems := schemas.Problems(types.ParsedToolCall{Name: "Read", Input: map[string]interface{}{"file_path": "/a"}}, nil); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+	if problems := schemas.Problems(types.ParsedToolCall{Name: "Read", Input: map[string]interface{}{}}, nil); len(problems) != 1 {
+		t.Errorf("Expected missing required parameter, got %v", problems)
+	}
+	if problems := schemas.Problems(types.ParsedToolCall{Name: "Write", Input: map[string]interface{}{}}, nil); len(problems) != 1 {
+		t.Errorf("Expected unknown tool, got %v", problems)
+	}
+}
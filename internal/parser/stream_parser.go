@@ -0,0 +1,365 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// EventType 流式解析事件类型
+type EventType int
+
+const (
+	EventText       EventType = iota // 工具调用之外的文本
+	EventToolStart                   // <invoke name="..."> 开始，Name 为工具名称
+	EventParamStart                  // <parameter name="..."> 开始，Name 为参数名称
+	EventParamChunk                  // 参数值的一段原始文本（CDATA 已展开）
+	EventParamEnd                    // 参数值结束
+	EventToolEnd                     // 工具调用结束
+)
+
+// Event 流式解析事件
+type Event struct {
+	Type EventType
+	Name string
+	Text string
+}
+
+// 解析状态
+type streamState int
+
+const (
+	stateText   streamState = iota // 工具调用之外
+	stateCalls                     // 在 <function_calls> 等包装标签内、invoke 之外
+	stateInvoke                    // 在 invoke 内、parameter 之外
+	stateValue                     // 在参数值内
+	stateCDATA                     // 在参数值的 CDATA 段内
+)
+
+const (
+	invokeOpenPrefix = `<invoke name="`
+	paramOpenPrefix  = `<parameter name="`
+	invokeCloseTag   = "</invoke>"
+	paramCloseTag    = "</parameter>"
+	cdataOpenTag     = "<![CDATA["
+	cdataCloseTag    = "]]>"
+)
+
+// 包装工具调用的标签
+var wrapperTags = []string{"function_calls", "tools", "tool"}
+
+var (
+	invokeOpenRegex = regexp.MustCompile(`^<invoke name="([^"]+)">`)
+	paramOpenRegex  = regexp.MustCompile(`^<parameter name="([^"]+)">`)
+	nestedOpenRegex = regexp.MustCompile(`^<(?:invoke|parameter) name="[^"]*">`)
+)
+
+// StreamParser 工具调用的增量解析器：在多次 Feed 之间保持状态，每段文本只扫描一次。
+// 不完整的标签会保留到下一次 Feed，参数值中的 XML 文本、嵌套的 invoke/parameter 标签
+// 和 CDATA 段按原样作为参数值输出
+type StreamParser struct {
+	state   streamState
+	pending string // 尚未处理的文本，通常是不完整的标签
+	space   string // 文本末尾暂缓输出的空白，工具调用开始时丢弃
+	wrapper string // 当前所在的包装标签，invoke 不在包装标签内时为空
+	depth   int    // 参数值内嵌套的 invoke/parameter 标签层数
+	final   bool   // 正在结束解析，不完整的标签按普通文本处理
+	events  []Event
+}
+
+// NewStreamParser 创建增量解析器
+func NewStreamParser() *StreamParser {
+	return &StreamParser{}
+}
+
+// Feed 解析新到达的文本，返回产生的事件
+func (p *StreamParser) Feed(text string) []Event {
+	p.pending += text
+	p.run()
+	return p.take()
+}
+
+// Finish 结束解析：输出剩余文本，关闭未结束的参数和工具调用，然后重置为初始状态
+func (p *StreamParser) Finish() []Event {
+	p.final = true
+	p.run()
+	switch p.state {
+	case stateText:
+		p.emit(EventText, "", p.space)
+	case stateValue, stateCDATA:
+		p.emit(EventParamEnd, "", "")
+		p.emit(EventToolEnd, "", "")
+	case stateInvoke:
+		p.emit(EventToolEnd, "", "")
+	}
+	events := p.take()
+	*p = StreamParser{}
+	return events
+}
+
+// run 处理 pending 中的文本，直到需要更多输入
+func (p *StreamParser) run() {
+	for p.pending != "" {
+		var ok bool
+		switch p.state {
+		case stateText:
+			ok = p.scanText()
+		case stateCalls:
+			ok = p.scanCalls()
+		case stateInvoke:
+			ok = p.scanInvoke()
+		case stateValue:
+			ok = p.scanValue()
+		case stateCDATA:
+			ok = p.scanCDATA()
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// scanText 工具调用之外：输出文本，遇到包装标签或 invoke 开始标签时进入工具调用
+func (p *StreamParser) scanText() bool {
+	idx := strings.IndexByte(p.pending, '<')
+	if idx == -1 {
+		p.emitText(p.pending)
+		p.pending = ""
+		return false
+	}
+	p.emitText(p.pending[:idx])
+	p.pending = p.pending[idx:]
+
+	for _, name := range wrapperTags {
+		tag := "<" + name + ">"
+		if strings.HasPrefix(p.pending, tag) {
+			p.space = ""
+			p.wrapper = name
+			p.state = stateCalls
+			p.pending = p.pending[len(tag):]
+			return true
+		}
+	}
+	if p.startInvoke() {
+		return true
+	}
+
+	if p.partial(invokeOpenPrefix) || p.partial("<function_calls>") || p.partial("<tools>") {
+		return false
+	}
+	p.emitText("<")
+	p.pending = p.pending[1:]
+	return true
+}
+
+// scanCalls 包装标签内：忽略 invoke 之间的空白和其他文本
+func (p *StreamParser) scanCalls() bool {
+	if !p.skipToTag() {
+		return false
+	}
+
+	closeTag := "</" + p.wrapper + ">"
+	if strings.HasPrefix(p.pending, closeTag) {
+		p.wrapper = ""
+		p.state = stateText
+		p.pending = p.pending[len(closeTag):]
+		return true
+	}
+	if p.startInvoke() {
+		return true
+	}
+
+	if p.partial(closeTag) || p.partial(invokeOpenPrefix) {
+		return false
+	}
+	p.pending = p.pending[1:]
+	return true
+}
+
+// scanInvoke invoke 内：识别参数开始标签和 </invoke>
+func (p *StreamParser) scanInvoke() bool {
+	if !p.skipToTag() {
+		return false
+	}
+
+	if strings.HasPrefix(p.pending, invokeCloseTag) {
+		p.pending = p.pending[len(invokeCloseTag):]
+		p.endInvoke()
+		return true
+	}
+	if match := paramOpenRegex.FindStringSubmatch(p.pending); match != nil {
+		p.emit(EventParamStart, match[1], "")
+		p.depth = 0
+		p.state = stateValue
+		p.pending = p.pending[len(match[0]):]
+		return true
+	}
+
+	if p.partial(invokeCloseTag) || p.partial(paramOpenPrefix) {
+		return false
+	}
+	p.pending = p.pending[1:]
+	return true
+}
+
+// scanValue 参数值内：除了结束标签和 CDATA 之外的内容都作为参数值输出，
+// 嵌套的 invoke/parameter 标签计入层数，遇到对应的结束标签前不会结束参数
+func (p *StreamParser) scanValue() bool {
+	idx := strings.IndexByte(p.pending, '<')
+	if idx == -1 {
+		p.emitChunk(p.pending)
+		p.pending = ""
+		return false
+	}
+	p.emitChunk(p.pending[:idx])
+	p.pending = p.pending[idx:]
+
+	switch {
+	case strings.HasPrefix(p.pending, cdataOpenTag):
+		p.state = stateCDATA
+		p.pending = p.pending[len(cdataOpenTag):]
+		return true
+	case strings.HasPrefix(p.pending, paramCloseTag) && p.depth == 0:
+		p.emit(EventParamEnd, "", "")
+		p.state = stateInvoke
+		p.pending = p.pending[len(paramCloseTag):]
+		return true
+	case strings.HasPrefix(p.pending, invokeCloseTag) && p.depth == 0:
+		// 缺少 </parameter>，参数随 invoke 一起结束
+		p.emit(EventParamEnd, "", "")
+		p.pending = p.pending[len(invokeCloseTag):]
+		p.endInvoke()
+		return true
+	}
+
+	for _, closeTag := range []string{paramCloseTag, invokeCloseTag} {
+		if strings.HasPrefix(p.pending, closeTag) {
+			p.depth--
+			p.emitChunk(closeTag)
+			p.pending = p.pending[len(closeTag):]
+			return true
+		}
+	}
+	if match := nestedOpenRegex.FindString(p.pending); match != "" {
+		p.depth++
+		p.emitChunk(match)
+		p.pending = p.pending[len(match):]
+		return true
+	}
+
+	if p.partial(cdataOpenTag) || p.partial(paramCloseTag) || p.partial(invokeCloseTag) ||
+		p.partial(paramOpenPrefix) || p.partial(invokeOpenPrefix) {
+		return false
+	}
+	p.emitChunk("<")
+	p.pending = p.pending[1:]
+	return true
+}
+
+// scanCDATA CDATA 段内：原样输出直到 ]]>
+func (p *StreamParser) scanCDATA() bool {
+	idx := strings.Index(p.pending, cdataCloseTag)
+	if idx == -1 {
+		// 保留末尾可能是 ]]> 一部分的字符
+		keep := 0
+		if !p.final {
+			for n := len(cdataCloseTag) - 1; n > 0; n-- {
+				if strings.HasSuffix(p.pending, cdataCloseTag[:n]) {
+					keep = n
+					break
+				}
+			}
+		}
+		p.emitChunk(p.pending[:len(p.pending)-keep])
+		p.pending = p.pending[len(p.pending)-keep:]
+		return false
+	}
+	p.emitChunk(p.pending[:idx])
+	p.state = stateValue
+	p.pending = p.pending[idx+len(cdataCloseTag):]
+	return true
+}
+
+// startInvoke pending 以完整的 invoke 开始标签开头时开始工具调用
+func (p *StreamParser) startInvoke() bool {
+	match := invokeOpenRegex.FindStringSubmatch(p.pending)
+	if match == nil {
+		return false
+	}
+	p.space = ""
+	p.emit(EventToolStart, match[1], "")
+	p.state = stateInvoke
+	p.pending = p.pending[len(match[0]):]
+	return true
+}
+
+// endInvoke 结束工具调用，回到包装标签内或普通文本
+func (p *StreamParser) endInvoke() {
+	p.emit(EventToolEnd, "", "")
+	if p.wrapper != "" {
+		p.state = stateCalls
+	} else {
+		p.state = stateText
+	}
+}
+
+// skipToTag 跳过下一个 < 之前的内容，没有 < 时返回 false
+func (p *StreamParser) skipToTag() bool {
+	idx := strings.IndexByte(p.pending, '<')
+	if idx == -1 {
+		p.pending = ""
+		return false
+	}
+	p.pending = p.pending[idx:]
+	return true
+}
+
+// partial pending 是否可能在更多文本到达后成为 tag。以 =" 结尾的 tag 表示开始标签的前缀，
+// 在出现 > 之前都视为不完整
+func (p *StreamParser) partial(tag string) bool {
+	if p.final {
+		return false
+	}
+	if len(p.pending) < len(tag) {
+		return strings.HasPrefix(tag, p.pending)
+	}
+	return strings.HasSuffix(tag, `="`) && strings.HasPrefix(p.pending, tag) && !strings.Contains(p.pending, ">")
+}
+
+// emitText 输出工具调用之外的文本，末尾的空白暂缓输出
+func (p *StreamParser) emitText(text string) {
+	if text == "" {
+		return
+	}
+	text = p.space + text
+	content := strings.TrimRight(text, " \t\r\n")
+	p.space = text[len(content):]
+	if p.final {
+		content, p.space = text, ""
+	}
+	p.emit(EventText, "", content)
+}
+
+// emitChunk 输出一段参数值
+func (p *StreamParser) emitChunk(text string) {
+	p.emit(EventParamChunk, "", text)
+}
+
+// emit 添加事件，相邻的文本或参数值事件会合并
+func (p *StreamParser) emit(eventType EventType, name, text string) {
+	if eventType == EventText || eventType == EventParamChunk {
+		if text == "" {
+			return
+		}
+		if n := len(p.events); n > 0 && p.events[n-1].Type == eventType {
+			p.events[n-1].Text += text
+			return
+		}
+	}
+	p.events = append(p.events, Event{Type: eventType, Name: name, Text: text})
+}
+
+func (p *StreamParser) take() []Event {
+	events := p.events
+	p.events = nil
+	return events
+}
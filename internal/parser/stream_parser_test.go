@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseInChunks 按固定长度分段输入文本，返回合并后的事件
+func parseInChunks(text string, chunkSize int) []Event {
+	parser := NewStreamParser()
+	var events []Event
+	add := func(newEvents []Event) {
+		for _, event := range newEvents {
+			n := len(events)
+			if n > 0 && (event.Type == EventText || event.Type == EventParamChunk) && events[n-1].Type == event.Type {
+				events[n-1].Text += event.Text
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+	for i := 0; i < len(text); i += chunkSize {
+		end := i + chunkSize
+		if end > len(text) {
+			end = len(text)
+		}
+		add(parser.Feed(text[i:end]))
+	}
+	add(parser.Finish())
+	return events
+}
+
+func TestStreamParserEvents(t *testing.T) {
+	// 测试文本、工具调用和参数事件，以及参数值中的 XML 文本、嵌套标签和 CDATA
+	text := `Let me check a < b.
+<function_calls>
+<invoke name="Write">
+<parameter name="content"><div><parameter name="x">1</parameter></div></parameter>
+<parameter name="raw"><![CDATA[</parameter></invoke>]]></parameter>
+</invoke>
+<invoke name="Bash"><parameter name="command">ls</invoke>
+</function_calls>
+Done.`
+
+	expected := []Event{
+		{Type: EventText, Text: "Let me check a < b."},
+		{Type: EventToolStart, Name: "Write"},
+		{Type: EventParamStart, Name: "content"},
+		{Type: EventParamChunk, Text: `<div><parameter name="x">1</parameter></div>`},
+		{Type: EventParamEnd},
+		{Type: EventParamStart, Name: "raw"},
+		{Type: EventParamChunk, Text: `</parameter></invoke>`},
+		{Type: EventParamEnd},
+		{Type: EventToolEnd},
+		{Type: EventToolStart, Name: "Bash"},
+		{Type: EventParamStart, Name: "command"},
+		{Type: EventParamChunk, Text: "ls"},
+		{Type: EventParamEnd},
+		{Type: EventToolEnd},
+		{Type: EventText, Text: "\nDone."},
+	}
+
+	// 每种分段方式的结果都应该相同
+	for _, chunkSize := range []int{1, 2, 3, 7, len(text)} {
+		events := parseInChunks(text, chunkSize)
+		if !reflect.DeepEqual(events, expected) {
+			t.Errorf("chunk size %d: expected %+v, got %+v", chunkSize, expected, events)
+		}
+	}
+}
+
+func TestStreamParserIncomplete(t *testing.T) {
+	// 测试未结束的工具调用在 Finish 时关闭，未完成的包装标签不作为文本输出
+	events := parseInChunks(`<invoke name="Read"><parameter name="file_path">/tmp/a`, 5)
+	expected := []Event{
+		{Type: EventToolStart, Name: "Read"},
+		{Type: EventParamStart, Name: "file_path"},
+		{Type: EventParamChunk, Text: "/tmp/a"},
+		{Type: EventParamEnd},
+		{Type: EventToolEnd},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, events)
+	}
+
+	events = parseInChunks("Working on it.\n<function_calls>\n<inv", 4)
+	if len(events) != 1 || events[0].Text != "Working on it." {
+		t.Errorf("Expected only the text before the tool call, got %+v", events)
+	}
+
+	// 不是标签的 < 在结束时作为文本输出
+	events = parseInChunks("a <inv", 3)
+	if len(events) != 1 || events[0].Text != "a <inv" {
+		t.Errorf("Expected literal text, got %+v", events)
+	}
+}
+
+func TestStreamParserLongValue(t *testing.T) {
+	// 测试逐字输入很长的参数值，每段文本只扫描一次
+	value := strings.Repeat("x", 200000)
+	parser := NewStreamParser()
+	parser.Feed(`<function_calls><invoke name="Write"><parameter name="content">`)
+	size := 0
+	for i := 0; i < len(value); i++ {
+		for _, event := range parser.Feed(value[i : i+1]) {
+			size += len(event.Text)
+		}
+	}
+	if size != len(value) {
+		t.Errorf("Expected %d bytes of parameter value, got %d", len(value), size)
+	}
+
+	result := ParseToolCalls(`<function_calls><invoke name="Write"><parameter name="content">`+value+`</parameter></invoke></function_calls>`, nil)
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Input["content"] != value {
+		t.Error("Expected the long parameter value to be parsed")
+	}
+}
@@ -1,11 +1,12 @@
 package parser
 
 import (
+	"opus-api/internal/types"
 	"testing"
 )
 
 func TestTaskIdAsString(t *testing.T) {
-	// 测试 taskId 参数应该保持为字符串类型，即使值看起来像数字
+	// 测试 schema 中声明为字符串的 taskId 参数应该保持为字符串类型，即使值看起来像数字
 	text := `<function_calls>
 <invoke name="TaskUpdate">
 <parameter name="taskId">1</parameter>
@@ -13,7 +14,17 @@ func TestTaskIdAsString(t *testing.T) {
 </invoke>
 </function_calls>`
 
-	result := ParseToolCalls(text)
+	schemas := NewToolSchemas([]types.ClaudeTool{{
+		Name: "TaskUpdate",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"taskId": map[string]interface{}{"type": "string"},
+				"status": map[string]interface{}{"type": "string"},
+			},
+		},
+	}})
+	result := ParseToolCalls(text, schemas)
 
 	if len(result.ToolCalls) != 1 {
 		t.Fatalf("Expected 1 tool call, got %d", len(result.ToolCalls))
@@ -64,7 +75,7 @@ func TestOtherNumericParams(t *testing.T) {
 </invoke>
 </function_calls>`
 
-	result := ParseToolCalls(text)
+	result := ParseToolCalls(text, nil)
 
 	if len(result.ToolCalls) != 1 {
 		t.Fatalf("Expected 1 tool call, got %d", len(result.ToolCalls))
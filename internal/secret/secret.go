@@ -0,0 +1,263 @@
+// Package secret 使用 AES-GCM 信封加密保护存储在数据库中的敏感字段。
+//
+// 每个值使用随机生成的数据密钥加密，数据密钥再由主密钥加密后与密文一起保存：
+//
+//	enc:v1:<主密钥 ID>:<加密的数据密钥>:<nonce + 密文>
+//
+// 更换主密钥时只需用新主密钥重新加密数据密钥，见 Keyring.Rewrap。
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	prefix  = "enc:v1:"
+	keySize = 32 // AES-256
+)
+
+var (
+	// ErrNoKey 数据已加密但没有配置主密钥
+	ErrNoKey = errors.New("value is encrypted but no encryption key is configured")
+	// ErrUnknownKey 加密数据使用的主密钥不在当前配置中
+	ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+	// ErrMalformed 加密数据格式错误
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+// masterKey 主密钥及其 ID（SHA-256 的前 4 字节）
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring 当前主密钥和用于解密旧数据的历史主密钥
+type Keyring struct {
+	current  *masterKey
+	previous map[string]*masterKey
+}
+
+// NewKeyring 创建密钥环，密钥为 32 字节的 base64 或 hex 编码；第一个为当前主密钥
+func NewKeyring(current string, previous ...string) (*Keyring, error) {
+	key, err := parseMasterKey(current)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{current: key, previous: make(map[string]*masterKey)}
+	for _, encoded := range previous {
+		old, err := parseMasterKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("previous key: %w", err)
+		}
+		if old.id != key.id {
+			k.previous[old.id] = old
+		}
+	}
+	return k, nil
+}
+
+// LoadKeyringFromEnv 从 ENCRYPTION_KEY / ENCRYPTION_PREVIOUS_KEYS 或 ENCRYPTION_KEY_FILE 加载密钥环。
+// 密钥文件每行一个密钥，第一行为当前主密钥，其余为历史主密钥。未配置时返回 nil
+func LoadKeyringFromEnv() (*Keyring, error) {
+	var keys []string
+	if path := os.Getenv("ENCRYPTION_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read ENCRYPTION_KEY_FILE: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	} else if current := strings.TrimSpace(os.Getenv("ENCRYPTION_KEY")); current != "" {
+		keys = append(keys, current)
+		for _, old := range strings.Split(os.Getenv("ENCRYPTION_PREVIOUS_KEYS"), ",") {
+			if old = strings.TrimSpace(old); old != "" {
+				keys = append(keys, old)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(keys[0], keys[1:]...)
+}
+
+// parseMasterKey 解析 base64 或 hex 编码的 32 字节密钥
+func parseMasterKey(encoded string) (*masterKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != keySize {
+		raw, err = hex.DecodeString(encoded)
+	}
+	if err != nil || len(raw) != keySize {
+		return nil, errors.New("encryption key must be 32 bytes encoded as base64 or hex (e.g. openssl rand -base64 32)")
+	}
+
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密并在密文前附加随机 nonce
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open 解密 seal 的结果
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// IsEncrypted 是否为加密后的值
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt 使用新的数据密钥加密，数据密钥由当前主密钥加密
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(aead, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.current.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return format(k.current.id, wrapped, ciphertext), nil
+}
+
+// Decrypt 解密 Encrypt 的结果，未加密的值原样返回（兼容加密前写入的数据）
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if k == nil {
+		return "", ErrNoKey
+	}
+
+	key, wrapped, ciphertext, err := k.parse(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(key.aead, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("decrypt data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRewrap 值是否未加密或使用了历史主密钥
+func (k *Keyring) NeedsRewrap(value string) bool {
+	if !IsEncrypted(value) {
+		return true
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id != k.current.id
+}
+
+// Rewrap 用当前主密钥重新加密：未加密的值直接加密，使用历史主密钥的值只重新加密数据密钥
+func (k *Keyring) Rewrap(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return k.Encrypt(value)
+	}
+	if !k.NeedsRewrap(value) {
+		return value, nil
+	}
+
+	key, wrapped, ciphertext, err := k.parse(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(key.aead, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("decrypt data key: %w", err)
+	}
+	rewrapped, err := seal(k.current.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return format(k.current.id, rewrapped, ciphertext), nil
+}
+
+// parse 拆分加密值并找到对应的主密钥
+func (k *Keyring) parse(value string) (*masterKey, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, nil, ErrMalformed
+	}
+
+	key := k.current
+	if parts[0] != key.id {
+		var ok bool
+		if key, ok = k.previous[parts[0]]; !ok {
+			return nil, nil, nil, ErrUnknownKey
+		}
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, nil, ErrMalformed
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, nil, ErrMalformed
+	}
+	return key, wrapped, ciphertext, nil
+}
+
+func format(keyID string, wrapped, ciphertext []byte) string {
+	return prefix + keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext)
+}
@@ -0,0 +1,109 @@
+package secret
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testKey  = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="                     // base64
+	otherKey = "6665646362613938373635343332313066656463626139383736353433323130" // hex
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	k, err := NewKeyring(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := k.Encrypt("session=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "abc") {
+		t.Fatalf("value not encrypted: %q", encrypted)
+	}
+
+	again, _ := k.Encrypt("session=abc")
+	if again == encrypted {
+		t.Error("each value should use a fresh data key and nonce")
+	}
+
+	plaintext, err := k.Decrypt(encrypted)
+	if err != nil || plaintext != "session=abc" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+}
+
+func TestDecryptPlaintext(t *testing.T) {
+	var k *Keyring
+	if got, err := k.Decrypt("legacy"); err != nil || got != "legacy" {
+		t.Errorf("plaintext passthrough = %q, %v", got, err)
+	}
+
+	encrypted, _ := mustKeyring(t, testKey).Encrypt("x")
+	if _, err := k.Decrypt(encrypted); err != ErrNoKey {
+		t.Errorf("err = %v, want ErrNoKey", err)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := mustKeyring(t, otherKey)
+	encrypted, _ := old.Encrypt("session=abc")
+
+	// Without the previous key the value is unreadable
+	if _, err := mustKeyring(t, testKey).Decrypt(encrypted); err != ErrUnknownKey {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+
+	k := mustKeyring(t, testKey, otherKey)
+	if !k.NeedsRewrap(encrypted) || !k.NeedsRewrap("plaintext") {
+		t.Fatal("old and plaintext values should need rewrapping")
+	}
+
+	rewrapped, err := k.Rewrap(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.NeedsRewrap(rewrapped) {
+		t.Error("rewrapped value still uses the old key")
+	}
+	if got, err := mustKeyring(t, testKey).Decrypt(rewrapped); err != nil || got != "session=abc" {
+		t.Errorf("Decrypt with new key only = %q, %v", got, err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	for _, key := range []string{"", "short", "MDEyMzQ1Njc4OQ=="} {
+		if _, err := NewKeyring(key); err == nil {
+			t.Errorf("NewKeyring(%q) should fail", key)
+		}
+	}
+}
+
+func TestLoadKeyringFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY_FILE", "")
+	t.Setenv("ENCRYPTION_KEY", "")
+	if k, err := LoadKeyringFromEnv(); k != nil || err != nil {
+		t.Fatalf("unset = %v, %v", k, err)
+	}
+
+	t.Setenv("ENCRYPTION_KEY", testKey)
+	t.Setenv("ENCRYPTION_PREVIOUS_KEYS", " "+otherKey+" ,")
+	k, err := LoadKeyringFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.previous) != 1 {
+		t.Errorf("got %d previous keys, want 1", len(k.previous))
+	}
+}
+
+func mustKeyring(t *testing.T, current string, previous ...string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(current, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultAffinityTTL 会话绑定的默认有效期，每次使用后重新计时
+const DefaultAffinityTTL = 30 * time.Minute
+
+// affinityEntry 会话绑定的 Cookie 及过期时间
+type affinityEntry struct {
+	cookieID  uint
+	expiresAt time.Time
+}
+
+// CookieAffinity 在内存中记录会话到 Cookie 的绑定，使同一会话的多轮请求使用同一个上游账号。
+// ttl 为 0 时禁用
+type CookieAffinity struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]affinityEntry
+	sweptAt time.Time
+}
+
+// NewCookieAffinity 创建会话绑定记录
+func NewCookieAffinity(ttl time.Duration) *CookieAffinity {
+	return &CookieAffinity{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]affinityEntry),
+	}
+}
+
+// Enabled 是否启用会话绑定
+func (a *CookieAffinity) Enabled() bool {
+	return a != nil && a.ttl > 0
+}
+
+// Lookup 获取会话绑定的 Cookie，未绑定或已过期时返回 false
+func (a *CookieAffinity) Lookup(key string) (uint, bool) {
+	if !a.Enabled() {
+		return 0, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.entries[key]
+	if !ok {
+		return 0, false
+	}
+	if !a.now().Before(entry.expiresAt) {
+		delete(a.entries, key)
+		return 0, false
+	}
+	return entry.cookieID, true
+}
+
+// Bind 把会话绑定到 Cookie，已绑定时更新 Cookie 并重新计时
+func (a *CookieAffinity) Bind(key string, cookieID uint) {
+	if !a.Enabled() {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	a.entries[key] = affinityEntry{cookieID: cookieID, expiresAt: now.Add(a.ttl)}
+
+	// 每个 TTL 周期清理一次过期的绑定
+	if now.Sub(a.sweptAt) >= a.ttl {
+		for k, entry := range a.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(a.entries, k)
+			}
+		}
+		a.sweptAt = now
+	}
+}
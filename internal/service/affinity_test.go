@@ -0,0 +1,58 @@
+package service
+
+import (
+	"opus-api/internal/model"
+	"testing"
+	"time"
+)
+
+func TestAffinityExpiry(t *testing.T) {
+	now := time.Now()
+	a := NewCookieAffinity(time.Minute)
+	a.now = func() time.Time { return now }
+
+	a.Bind("session", 7)
+	if id, ok := a.Lookup("session"); !ok || id != 7 {
+		t.Fatalf("Lookup = %d, %v, want 7", id, ok)
+	}
+
+	// 再次绑定后重新计时
+	now = now.Add(50 * time.Second)
+	a.Bind("session", 7)
+	now = now.Add(50 * time.Second)
+	if _, ok := a.Lookup("session"); !ok {
+		t.Fatal("binding should be refreshed by Bind")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := a.Lookup("session"); ok {
+		t.Fatal("binding should expire after the TTL")
+	}
+}
+
+func TestAffinityDisabled(t *testing.T) {
+	a := NewCookieAffinity(0)
+	a.Bind("session", 7)
+	if _, ok := a.Lookup("session"); ok {
+		t.Fatal("disabled affinity should not bind")
+	}
+}
+
+func TestBoundCookie(t *testing.T) {
+	r := &CookieRotator{affinity: NewCookieAffinity(time.Minute)}
+	cookies := []model.MorphCookie{{ID: 1}, {ID: 2}}
+
+	if got := r.boundCookie("session", cookies); got != nil {
+		t.Fatalf("unbound session returned cookie %d", got.ID)
+	}
+
+	r.affinity.Bind("session", 2)
+	if got := r.boundCookie("session", cookies); got == nil || got.ID != 2 {
+		t.Fatalf("boundCookie = %+v, want cookie 2", got)
+	}
+
+	// 绑定的 Cookie 不再是候选（例如已失效）时需要重新选择
+	if got := r.boundCookie("session", cookies[:1]); got != nil {
+		t.Fatalf("unavailable cookie should not be returned, got %d", got.ID)
+	}
+}
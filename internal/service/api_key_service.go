@@ -0,0 +1,110 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"opus-api/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix 生成的 API Key 的前缀
+const APIKeyPrefix = "sk-opus-"
+
+// apiKeyDisplayLength 列表中展示的明文长度
+const apiKeyDisplayLength = len(APIKeyPrefix) + 6
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrInvalidKeyPool = errors.New("invalid cookie pool name")
+)
+
+// APIKeyService API Key 管理服务
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyService 创建 API Key 服务
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// APIKeyOptions 创建 API Key 时的选项
+type APIKeyOptions struct {
+	OwnCookiesOnly      bool   // 只使用所属用户的 Cookie
+	CookiePool          string // 绑定的 Cookie 池，为空时不限制
+	AllowCookieOverride bool   // 允许通过请求头指定上游 Cookie
+}
+
+// CreateKey 为用户生成新的 API Key，明文只在此处返回一次
+func (s *APIKeyService) CreateKey(userID uint, name string, opts APIKeyOptions) (*model.APIKey, string, error) {
+	if len(opts.CookiePool) > maxPoolNameLength {
+		return nil, "", ErrInvalidKeyPool
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	rawKey := APIKeyPrefix + hex.EncodeToString(buf)
+
+	key := &model.APIKey{
+		UserID:              userID,
+		Name:                name,
+		KeyHash:             hashToken(rawKey),
+		KeyPrefix:           rawKey[:apiKeyDisplayLength],
+		OwnCookiesOnly:      opts.OwnCookiesOnly,
+		CookiePool:          opts.CookiePool,
+		AllowCookieOverride: opts.AllowCookieOverride,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	return key, rawKey, nil
+}
+
+// ListKeys 获取用户的所有 API Key
+func (s *APIKeyService) ListKeys(userID uint) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := s.db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RevokeKey 吊销 API Key
+func (s *APIKeyService) RevokeKey(id, userID uint) error {
+	result := s.db.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ValidateKey 校验明文 API Key 并记录使用
+func (s *APIKeyService) ValidateKey(rawKey string) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := s.db.Where("key_hash = ? AND revoked_at IS NULL", hashToken(rawKey)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	s.db.Model(&model.APIKey{}).
+		Where("id = ?", key.ID).
+		Updates(map[string]interface{}{
+			"usage_count": gorm.Expr("usage_count + ?", 1),
+			"last_used":   time.Now(),
+		})
+
+	return &key, nil
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"opus-api/internal/model"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 导入格式
+const (
+	ImportFormatJSON  = "json"
+	ImportFormatCSV   = "csv"
+	ImportFormatLines = "lines" // 每行一个 Cookie 字符串
+)
+
+// 导入结果状态
+const (
+	ImportStatusCreated   = "created"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusInvalid   = "invalid" // 行内容有误，未导入
+	ImportStatusError     = "error"   // 写入数据库失败
+)
+
+// Cookie 名称和池名称的最大长度（与数据库列一致）
+const (
+	maxCookieNameLength = 100
+	maxPoolNameLength   = 50
+)
+
+// ErrUnknownImportFormat 不支持的导入格式
+var ErrUnknownImportFormat = errors.New("unknown import format, expected json, csv or lines")
+
+// ImportRow 待导入的一行
+type ImportRow struct {
+	Name            string `json:"name"`
+	APIKey          string `json:"api_key"`
+	SessionKey      string `json:"session_key"`
+	Priority        int    `json:"priority"`
+	Pool            string `json:"pool"`
+	RPMLimit        int    `json:"rpm_limit"`
+	DailyTokenLimit int64  `json:"daily_token_limit"`
+	MaxConcurrent   int    `json:"max_concurrent"`
+}
+
+// ImportResult 单行导入结果，Row 从 1 开始
+type ImportResult struct {
+	Row      int    `json:"row"`
+	Name     string `json:"name,omitempty"`
+	Status   string `json:"status"`
+	CookieID uint   `json:"cookie_id,omitempty"`
+	IsValid  *bool  `json:"is_valid,omitempty"` // 仅在导入时验证才返回
+	Error    string `json:"error,omitempty"`
+}
+
+// DetectImportFormat 根据内容猜测导入格式
+func DetectImportFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return ImportFormatJSON
+	}
+
+	firstLine, _, _ := strings.Cut(string(trimmed), "\n")
+	if strings.Contains(strings.ToLower(firstLine), "api_key") && strings.Contains(firstLine, ",") {
+		return ImportFormatCSV
+	}
+	return ImportFormatLines
+}
+
+// ParseImport 按格式解析导入数据
+func ParseImport(format string, data []byte) ([]ImportRow, error) {
+	switch format {
+	case ImportFormatJSON:
+		return parseImportJSON(data)
+	case ImportFormatCSV:
+		return parseImportCSV(data)
+	case ImportFormatLines:
+		return parseImportLines(data)
+	default:
+		return nil, ErrUnknownImportFormat
+	}
+}
+
+// parseImportJSON 解析 JSON 数组，元素可以是对象或 Cookie 字符串；也接受 {"cookies": [...]}
+func parseImportJSON(data []byte) ([]ImportRow, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapper struct {
+			Cookies json.RawMessage `json:"cookies"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapper); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if wrapper.Cookies == nil {
+			return nil, errors.New(`JSON object must contain a "cookies" array`)
+		}
+		trimmed = wrapper.Cookies
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	rows := make([]ImportRow, len(items))
+	for i, item := range items {
+		var raw string
+		if err := json.Unmarshal(item, &raw); err == nil {
+			rows[i] = ImportRow{APIKey: raw}
+			continue
+		}
+		// 无法解析的元素留空，在导入时报告为 invalid
+		json.Unmarshal(item, &rows[i])
+	}
+	return rows, nil
+}
+
+// parseImportCSV 解析带表头的 CSV，必须包含 api_key 列
+func parseImportCSV(data []byte) ([]ImportRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["api_key"]; !ok {
+		return nil, errors.New(`CSV header must contain an "api_key" column`)
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		row := ImportRow{
+			Name:       field(record, "name"),
+			APIKey:     field(record, "api_key"),
+			SessionKey: field(record, "session_key"),
+			Pool:       field(record, "pool"),
+		}
+		// 无效的优先级和限流上限按 0 处理
+		row.Priority, _ = strconv.Atoi(field(record, "priority"))
+		row.RPMLimit, _ = strconv.Atoi(field(record, "rpm_limit"))
+		row.DailyTokenLimit, _ = strconv.ParseInt(field(record, "daily_token_limit"), 10, 64)
+		row.MaxConcurrent, _ = strconv.Atoi(field(record, "max_concurrent"))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseImportLines 每个非空行是一个 Cookie 字符串，# 开头的行为注释
+func parseImportLines(data []byte) ([]ImportRow, error) {
+	var rows []ImportRow
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rows = append(rows, ImportRow{APIKey: line})
+	}
+	return rows, scanner.Err()
+}
+
+// ImportCookies 导入 Cookie：按 KeyHash 去重（包括与已有 Cookie 和同一批次内的重复），
+// 未指定池的行使用 defaultPool，返回每行的结果
+func (s *CookieService) ImportCookies(userID uint, rows []ImportRow, defaultPool string) ([]ImportResult, error) {
+	existing, err := s.KeyHashes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultPool == "" {
+		defaultPool = model.DefaultPool
+	}
+
+	results := make([]ImportResult, len(rows))
+	for i, row := range rows {
+		result := &results[i]
+		result.Row = i + 1
+
+		apiKey := strings.TrimSpace(row.APIKey)
+		if apiKey == "" {
+			result.Status = ImportStatusInvalid
+			result.Error = "api_key is required"
+			continue
+		}
+
+		hash := model.HashCookieKey(apiKey)
+		name := strings.TrimSpace(row.Name)
+		if name == "" {
+			name = "imported-" + hash[:8]
+		}
+		result.Name = name
+
+		if id, ok := existing[hash]; ok {
+			result.Status = ImportStatusDuplicate
+			result.CookieID = id
+			continue
+		}
+
+		pool := strings.TrimSpace(row.Pool)
+		if pool == "" {
+			pool = defaultPool
+		}
+		if len(pool) > maxPoolNameLength || len(name) > maxCookieNameLength {
+			result.Status = ImportStatusInvalid
+			result.Error = "name or pool is too long"
+			continue
+		}
+		if row.RPMLimit < 0 || row.DailyTokenLimit < 0 || row.MaxConcurrent < 0 {
+			result.Status = ImportStatusInvalid
+			result.Error = "limits must not be negative"
+			continue
+		}
+
+		cookie := &model.MorphCookie{
+			UserID:          userID,
+			Name:            name,
+			Pool:            pool,
+			APIKey:          apiKey,
+			SessionKey:      strings.TrimSpace(row.SessionKey),
+			Priority:        row.Priority,
+			RPMLimit:        row.RPMLimit,
+			DailyTokenLimit: row.DailyTokenLimit,
+			MaxConcurrent:   row.MaxConcurrent,
+			IsValid:         true,
+		}
+		if err := s.CreateCookie(cookie); err != nil {
+			result.Status = ImportStatusError
+			result.Error = "failed to create cookie"
+			continue
+		}
+
+		existing[hash] = cookie.ID
+		result.Status = ImportStatusCreated
+		result.CookieID = cookie.ID
+	}
+
+	return results, nil
+}
+
+// ValidateImported 以有限并发验证导入时新建的 Cookie，并把结果写回 results。
+// ctx 取消（如客户端断开）后不再开始新的验证，未完成验证的 Cookie 不写回结果
+func (v *CookieValidator) ValidateImported(ctx context.Context, userID uint, results []ImportResult) {
+	sem := make(chan struct{}, v.concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Status != ImportStatusCreated {
+			continue
+		}
+		cookie, err := v.service.GetCookie(results[i].CookieID, userID)
+		if err != nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(result *ImportResult, cookie *model.MorphCookie) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			validation := v.Validate(ctx, cookie, model.ValidationSourceManual)
+			if ctx.Err() != nil {
+				return
+			}
+			result.IsValid = &validation.IsValid
+		}(&results[i], cookie)
+	}
+	wg.Wait()
+}
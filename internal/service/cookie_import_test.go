@@ -0,0 +1,91 @@
+package service
+
+import "testing"
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`[{"api_key": "a"}]`, ImportFormatJSON},
+		{`  {"cookies": []}`, ImportFormatJSON},
+		{"name,api_key\nfirst,abc", ImportFormatCSV},
+		{"session=abc; other=1\nsession=def", ImportFormatLines},
+	}
+	for _, tt := range tests {
+		if got := DetectImportFormat([]byte(tt.data)); got != tt.want {
+			t.Errorf("DetectImportFormat(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseImportJSON(t *testing.T) {
+	rows, err := ParseImport(ImportFormatJSON, []byte(`[
+		{"name": "first", "api_key": "abc", "priority": 3, "pool": "team", "rpm_limit": 10, "daily_token_limit": 500000, "max_concurrent": 2},
+		"raw-cookie",
+		42
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if rows[0].Name != "first" || rows[0].APIKey != "abc" || rows[0].Priority != 3 || rows[0].Pool != "team" {
+		t.Errorf("unexpected first row %+v", rows[0])
+	}
+	if rows[0].RPMLimit != 10 || rows[0].DailyTokenLimit != 500000 || rows[0].MaxConcurrent != 2 {
+		t.Errorf("limits not imported: %+v", rows[0])
+	}
+	if rows[1].APIKey != "raw-cookie" {
+		t.Errorf("string element not used as api_key: %+v", rows[1])
+	}
+	// Unparseable elements are kept so the report lines up with the input
+	if rows[2].APIKey != "" {
+		t.Errorf("expected empty row for invalid element, got %+v", rows[2])
+	}
+
+	rows, err = ParseImport(ImportFormatJSON, []byte(`{"cookies": ["x", "y"]}`))
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("wrapped JSON: rows=%v err=%v", rows, err)
+	}
+}
+
+func TestParseImportCSV(t *testing.T) {
+	rows, err := ParseImport(ImportFormatCSV, []byte("Name,API_Key,priority,rpm_limit,daily_token_limit,max_concurrent\nfirst,\"a,b\",2,10,500000,2\nsecond,c,oops\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0].APIKey != "a,b" || rows[0].Priority != 2 {
+		t.Errorf("unexpected first row %+v", rows[0])
+	}
+	if rows[0].RPMLimit != 10 || rows[0].DailyTokenLimit != 500000 || rows[0].MaxConcurrent != 2 {
+		t.Errorf("limits not imported: %+v", rows[0])
+	}
+	if rows[1].Priority != 0 {
+		t.Errorf("invalid priority should be 0, got %d", rows[1].Priority)
+	}
+
+	if _, err := ParseImport(ImportFormatCSV, []byte("name,cookie\na,b\n")); err == nil {
+		t.Error("expected error for CSV without api_key column")
+	}
+}
+
+func TestParseImportLines(t *testing.T) {
+	rows, err := ParseImport(ImportFormatLines, []byte("# exported cookies\n\n  one  \r\ntwo\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].APIKey != "one" || rows[1].APIKey != "two" {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+}
+
+func TestParseImportUnknownFormat(t *testing.T) {
+	if _, err := ParseImport("xml", nil); err != ErrUnknownImportFormat {
+		t.Errorf("err = %v, want ErrUnknownImportFormat", err)
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"opus-api/internal/model"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -50,14 +51,30 @@ func (s *CookieService) GetCookie(id, userID uint) (*model.MorphCookie, error) {
 
 // CreateCookie 创建 Cookie
 func (s *CookieService) CreateCookie(cookie *model.MorphCookie) error {
+	cookie.KeyHash = model.HashCookieKey(cookie.APIKey)
 	return s.db.Create(cookie).Error
 }
 
 // UpdateCookie 更新 Cookie
 func (s *CookieService) UpdateCookie(cookie *model.MorphCookie) error {
+	cookie.KeyHash = model.HashCookieKey(cookie.APIKey)
 	return s.db.Save(cookie).Error
 }
 
+// KeyHashes 获取用户已有 Cookie 的 KeyHash 到 ID 的映射，用于导入去重
+func (s *CookieService) KeyHashes(userID uint) (map[string]uint, error) {
+	var cookies []model.MorphCookie
+	if err := s.db.Select("id", "key_hash").Where("user_id = ?", userID).Find(&cookies).Error; err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]uint, len(cookies))
+	for _, cookie := range cookies {
+		hashes[cookie.KeyHash] = cookie.ID
+	}
+	return hashes, nil
+}
+
 // DeleteCookie 删除 Cookie
 func (s *CookieService) DeleteCookie(id, userID uint) error {
 	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.MorphCookie{})
@@ -70,6 +87,13 @@ func (s *CookieService) DeleteCookie(id, userID uint) error {
 	return nil
 }
 
+// CookieIDs 获取用户所有 Cookie 的 ID
+func (s *CookieService) CookieIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := s.db.Model(&model.MorphCookie{}).Where("user_id = ?", userID).Pluck("id", &ids).Error
+	return ids, err
+}
+
 // GetStats 获取统计信息
 func (s *CookieService) GetStats(userID uint) (*model.CookieStats, error) {
 	stats := &model.CookieStats{}
@@ -91,6 +115,13 @@ func (s *CookieService) GetStats(userID uint) (*model.CookieStats, error) {
 	// 无效数量
 	stats.InvalidCount = stats.TotalCount - stats.ValidCount
 
+	// 冷却中的数量
+	if err := s.db.Model(&model.MorphCookie{}).
+		Where("user_id = ? AND is_valid = ? AND cooldown_until > ?", userID, true, time.Now()).
+		Count(&stats.CoolingCount).Error; err != nil {
+		return nil, err
+	}
+
 	// 总使用次数
 	var totalUsage *int64
 	if err := s.db.Model(&model.MorphCookie{}).
@@ -106,20 +137,105 @@ func (s *CookieService) GetStats(userID uint) (*model.CookieStats, error) {
 	return stats, nil
 }
 
-// GetValidCookies 获取所有有效的 Cookie
+// notCoolingDown 排除冷却中的 Cookie，冷却结束后自动恢复
+func notCoolingDown(db *gorm.DB) *gorm.DB {
+	return db.Where("cooldown_until IS NULL OR cooldown_until <= ?", time.Now())
+}
+
+// GetValidCookies 获取用户所有有效且不在冷却中的 Cookie
 func (s *CookieService) GetValidCookies(userID uint) ([]model.MorphCookie, error) {
 	var cookies []model.MorphCookie
-	err := s.db.Where("user_id = ? AND is_valid = ?", userID, true).
+	err := s.db.Scopes(notCoolingDown).
+		Where("user_id = ? AND is_valid = ?", userID, true).
 		Order("priority DESC, usage_count ASC").
 		Find(&cookies).Error
 	return cookies, err
 }
 
-// GetAllValidCookies 获取系统中所有有效的 Cookie（用于轮询）
-func (s *CookieService) GetAllValidCookies() ([]model.MorphCookie, error) {
+// sharedPoolNames 共享池名称的子查询
+func (s *CookieService) sharedPoolNames() *gorm.DB {
+	return s.db.Model(&model.CookiePool{}).Select("name").Where("shared = ?", true)
+}
+
+// GetSharedValidCookies 获取共享池中所有有效且不在冷却中的 Cookie
+func (s *CookieService) GetSharedValidCookies() ([]model.MorphCookie, error) {
 	var cookies []model.MorphCookie
-	err := s.db.Where("is_valid = ?", true).
+	err := s.db.Scopes(notCoolingDown).
+		Where("is_valid = ? AND pool IN (?)", true, s.sharedPoolNames()).
 		Order("priority DESC, usage_count ASC").
 		Find(&cookies).Error
 	return cookies, err
+}
+
+// GetPoolValidCookies 获取指定池中用户可以使用的有效且不在冷却中的 Cookie
+// （池为共享池，或 Cookie 属于该用户）
+func (s *CookieService) GetPoolValidCookies(pool string, userID uint) ([]model.MorphCookie, error) {
+	var cookies []model.MorphCookie
+	err := s.db.Scopes(notCoolingDown).
+		Where("is_valid = ? AND pool = ?", true, pool).
+		Where(s.db.Where("user_id = ?", userID).Or("pool IN (?)", s.sharedPoolNames())).
+		Order("priority DESC, usage_count ASC").
+		Find(&cookies).Error
+	return cookies, err
+}
+
+// PoolInfo Cookie 池信息
+type PoolInfo struct {
+	Name        string `json:"name"`
+	Shared      bool   `json:"shared"`
+	CookieCount int64  `json:"cookie_count"`
+	ValidCount  int64  `json:"valid_count"`
+}
+
+// ListPools 获取所有 Cookie 池（包括只被 Cookie 引用、尚未设置的池）
+func (s *CookieService) ListPools() ([]PoolInfo, error) {
+	var pools []model.CookiePool
+	if err := s.db.Order("name ASC").Find(&pools).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		Pool        string
+		CookieCount int64
+		ValidCount  int64
+	}
+	if err := s.db.Model(&model.MorphCookie{}).
+		Select("pool, COUNT(*) AS cookie_count, COUNT(CASE WHEN is_valid THEN 1 END) AS valid_count").
+		Group("pool").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]PoolInfo, 0, len(pools))
+	index := make(map[string]int, len(pools))
+	for _, pool := range pools {
+		index[pool.Name] = len(result)
+		result = append(result, PoolInfo{Name: pool.Name, Shared: pool.Shared})
+	}
+	for _, count := range counts {
+		i, ok := index[count.Pool]
+		if !ok {
+			i = len(result)
+			index[count.Pool] = i
+			result = append(result, PoolInfo{Name: count.Pool})
+		}
+		result[i].CookieCount = count.CookieCount
+		result[i].ValidCount = count.ValidCount
+	}
+	return result, nil
+}
+
+// SetPoolShared 设置池是否共享，池不存在时创建
+func (s *CookieService) SetPoolShared(name string, shared bool) (*model.CookiePool, error) {
+	var pool model.CookiePool
+	err := s.db.Where("name = ?", name).First(&pool).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	pool.Name = name
+	pool.Shared = shared
+	if err := s.db.Save(&pool).Error; err != nil {
+		return nil, err
+	}
+	return &pool, nil
 }
\ No newline at end of file
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// healthWindowSize 每个 Cookie 保留的最近请求样本数
+const healthWindowSize = 20
+
+// healthSampleTTL 样本的有效期，过期的样本不再参与统计，避免早已恢复的 Cookie 一直因旧的错误被冷落
+const healthSampleTTL = 10 * time.Minute
+
+// errorPenalty 错误率对评分的放大系数：错误率 50% 的 Cookie 评分相当于延迟乘以 (1 + 0.5*errorPenalty)
+const errorPenalty = 4.0
+
+// healthSample 一次上游请求的结果
+type healthSample struct {
+	ttfb time.Duration
+	ok   bool
+	at   time.Time
+}
+
+// CookieHealth 在内存中记录每个 Cookie 最近的首字节延迟和错误率（重启后清空）
+type CookieHealth struct {
+	mu      sync.Mutex
+	samples map[uint][]healthSample
+	now     func() time.Time
+}
+
+// CookieHealthStats Cookie 的近期健康状况
+type CookieHealthStats struct {
+	Samples   int     `json:"samples"`
+	AvgTTFBMs float64 `json:"avg_ttfb_ms"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// NewCookieHealth 创建健康状况记录器
+func NewCookieHealth() *CookieHealth {
+	return &CookieHealth{samples: make(map[uint][]healthSample), now: time.Now}
+}
+
+// RecordSuccess 记录一次成功请求及其首字节延迟
+func (h *CookieHealth) RecordSuccess(cookieID uint, ttfb time.Duration) {
+	h.record(cookieID, healthSample{ttfb: ttfb, ok: true})
+}
+
+// RecordError 记录一次失败请求
+func (h *CookieHealth) RecordError(cookieID uint) {
+	h.record(cookieID, healthSample{ok: false})
+}
+
+func (h *CookieHealth) record(cookieID uint, sample healthSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sample.at = h.now()
+	samples := append(h.recent(cookieID), sample)
+	if len(samples) > healthWindowSize {
+		samples = samples[len(samples)-healthWindowSize:]
+	}
+	h.samples[cookieID] = samples
+}
+
+// recent 返回 Cookie 未过期的样本并丢弃过期的样本，调用方需持有锁
+func (h *CookieHealth) recent(cookieID uint) []healthSample {
+	samples := h.samples[cookieID]
+	cutoff := h.now().Add(-healthSampleTTL)
+	i := 0
+	for i < len(samples) && !samples[i].at.After(cutoff) {
+		i++
+	}
+	if i == 0 {
+		return samples
+	}
+	if i == len(samples) {
+		delete(h.samples, cookieID)
+		return nil
+	}
+	samples = samples[i:]
+	h.samples[cookieID] = samples
+	return samples
+}
+
+// Stats 获取 Cookie 的近期健康状况
+func (h *CookieHealth) Stats(cookieID uint) CookieHealthStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return statsOf(h.recent(cookieID))
+}
+
+// Snapshot 获取所有有样本的 Cookie 的近期健康状况
+func (h *CookieHealth) Snapshot() map[uint]CookieHealthStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := make(map[uint]CookieHealthStats, len(h.samples))
+	for cookieID := range h.samples {
+		if samples := h.recent(cookieID); len(samples) > 0 {
+			snapshot[cookieID] = statsOf(samples)
+		}
+	}
+	return snapshot
+}
+
+// Score 评分越低越好，没有样本时返回 ok=false
+func (h *CookieHealth) Score(cookieID uint) (score float64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := h.recent(cookieID)
+	if len(samples) == 0 {
+		return 0, false
+	}
+	stats := statsOf(samples)
+	latency := stats.AvgTTFBMs
+	if latency == 0 {
+		// 只有失败样本时按窗口内的最大可能延迟处理
+		latency = float64(time.Minute.Milliseconds())
+	}
+	return latency * (1 + stats.ErrorRate*errorPenalty), true
+}
+
+func statsOf(samples []healthSample) CookieHealthStats {
+	stats := CookieHealthStats{Samples: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	var total time.Duration
+	var okCount, errCount int
+	for _, sample := range samples {
+		if sample.ok {
+			total += sample.ttfb
+			okCount++
+		} else {
+			errCount++
+		}
+	}
+	if okCount > 0 {
+		stats.AvgTTFBMs = float64(total) / float64(time.Millisecond) / float64(okCount)
+	}
+	stats.ErrorRate = float64(errCount) / float64(len(samples))
+	return stats
+}
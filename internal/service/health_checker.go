@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"opus-api/internal/model"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 后台健康检查默认配置
+const (
+	DefaultHealthCheckInterval        = 30 * time.Minute
+	DefaultHealthCheckInvalidInterval = 6 * time.Hour
+	DefaultHealthCheckJitter          = 30 * time.Second
+	DefaultHealthCheckConcurrency     = 4
+	DefaultValidationHistoryDays      = 7
+
+	// healthCheckScanInterval 扫描到期 Cookie 的最长间隔
+	healthCheckScanInterval = time.Minute
+)
+
+// cookieChecker 验证 Cookie、更新其状态并记录验证历史，由 CookieValidator 实现
+type cookieChecker interface {
+	Validate(ctx context.Context, cookie *model.MorphCookie, source string) ValidationResult
+}
+
+// healthCheckStore 健康检查读写的数据
+type healthCheckStore interface {
+	// CheckableCookies 获取所有不在冷却中的 Cookie
+	CheckableCookies() ([]model.MorphCookie, error)
+	// PruneValidations 删除 before 之前的验证历史，返回删除的条数
+	PruneValidations(before time.Time) (int64, error)
+}
+
+// HealthChecker 后台定时验证 Cookie，失效的 Cookie 以更长的间隔重新检测
+type HealthChecker struct {
+	validator       cookieChecker
+	store           healthCheckStore
+	interval        time.Duration // 有效 Cookie 的检测间隔，0 表示禁用
+	invalidInterval time.Duration // 失效 Cookie 的检测间隔
+	jitter          time.Duration // 每次检测前的随机延迟上限，避免同时请求上游
+	concurrency     int
+	historyDays     int
+	done            chan struct{}
+
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewHealthChecker 创建健康检查器，配置从环境变量读取
+func NewHealthChecker(validator *CookieValidator) *HealthChecker {
+	return &HealthChecker{
+		validator:       validator,
+		store:           dbHealthCheckStore{service: validator.service},
+		interval:        optionalDurationFromEnv("HEALTH_CHECK_INTERVAL", DefaultHealthCheckInterval),
+		invalidInterval: durationFromEnv("HEALTH_CHECK_INVALID_INTERVAL", DefaultHealthCheckInvalidInterval),
+		jitter:          optionalDurationFromEnv("HEALTH_CHECK_JITTER", DefaultHealthCheckJitter),
+		concurrency:     positiveIntFromEnv("HEALTH_CHECK_CONCURRENCY", DefaultHealthCheckConcurrency),
+		historyDays:     positiveIntFromEnv("VALIDATION_HISTORY_DAYS", DefaultValidationHistoryDays),
+		done:            make(chan struct{}),
+		now:             time.Now,
+		after:           time.After,
+	}
+}
+
+// optionalDurationFromEnv 从环境变量读取时长（单位秒），允许为 0
+func optionalDurationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		log.Printf("[WARN] Invalid %s %q, using %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// positiveIntFromEnv 从环境变量读取正整数
+func positiveIntFromEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("[WARN] Invalid %s %q, using %d", name, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// Start 在后台运行健康检查，ctx 取消后停止，Wait 等待正在进行的检测结束
+func (h *HealthChecker) Start(ctx context.Context) {
+	if h.interval == 0 {
+		log.Printf("[INFO] Background health checks disabled")
+		close(h.done)
+		return
+	}
+
+	log.Printf("[INFO] Background health checks every %v (invalid cookies every %v, concurrency %d)",
+		h.interval, h.invalidInterval, h.concurrency)
+
+	go func() {
+		defer close(h.done)
+
+		scanInterval := h.interval
+		if scanInterval > healthCheckScanInterval {
+			scanInterval = healthCheckScanInterval
+		}
+
+		for {
+			h.runOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.after(scanInterval):
+			}
+		}
+	}()
+}
+
+// Wait 阻塞直到健康检查停止
+func (h *HealthChecker) Wait() {
+	<-h.done
+}
+
+// runOnce 检测所有到期的 Cookie 并清理过期的验证历史
+func (h *HealthChecker) runOnce(ctx context.Context) {
+	cookies, err := h.dueCookies()
+	if err != nil {
+		log.Printf("[WARN] Health check failed to load cookies: %v", err)
+		return
+	}
+
+	if len(cookies) > 0 {
+		log.Printf("[INFO] Health check: validating %d cookie(s)", len(cookies))
+	}
+
+	sem := make(chan struct{}, h.concurrency)
+	var wg sync.WaitGroup
+	for i := range cookies {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(cookie *model.MorphCookie) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			h.checkCookie(ctx, cookie)
+		}(&cookies[i])
+	}
+	wg.Wait()
+
+	h.pruneHistory()
+}
+
+// checkCookie 随机延迟后验证单个 Cookie
+func (h *HealthChecker) checkCookie(ctx context.Context, cookie *model.MorphCookie) {
+	if h.jitter > 0 {
+		delay := time.Duration(rand.Int63n(int64(h.jitter)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.after(delay):
+		}
+	}
+
+	wasValid := cookie.IsValid
+	result := h.validator.Validate(ctx, cookie, model.ValidationSourceScheduled)
+	if ctx.Err() != nil {
+		return
+	}
+	if result.IsValid != wasValid {
+		log.Printf("[INFO] Health check: cookie %s (ID: %d) is now valid=%v", cookie.Name, cookie.ID, result.IsValid)
+	}
+}
+
+// dueCookies 获取到期需要检测的 Cookie，从未验证过的在前，其余按上次验证时间排序；冷却中的 Cookie 跳过
+func (h *HealthChecker) dueCookies() ([]model.MorphCookie, error) {
+	cookies, err := h.store.CheckableCookies()
+	if err != nil {
+		return nil, err
+	}
+
+	now := h.now()
+	var due []model.MorphCookie
+	for _, cookie := range cookies {
+		if h.isDue(&cookie, now) {
+			due = append(due, cookie)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := due[i].LastValidated, due[j].LastValidated
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	return due, nil
+}
+
+// isDue 判断 Cookie 是否需要检测：有效的 Cookie 按 interval，失效的按更长的 invalidInterval
+func (h *HealthChecker) isDue(cookie *model.MorphCookie, now time.Time) bool {
+	if cookie.LastValidated == nil {
+		return true
+	}
+	interval := h.interval
+	if !cookie.IsValid {
+		interval = h.invalidInterval
+	}
+	return !cookie.LastValidated.After(now.Add(-interval))
+}
+
+// pruneHistory 删除超过保留天数的验证历史
+func (h *HealthChecker) pruneHistory() {
+	cutoff := h.now().AddDate(0, 0, -h.historyDays)
+	pruned, err := h.store.PruneValidations(cutoff)
+	if err != nil {
+		log.Printf("[WARN] Failed to prune validation history: %v", err)
+	} else if pruned > 0 {
+		log.Printf("[INFO] Pruned %d validation record(s) older than %d day(s)", pruned, h.historyDays)
+	}
+}
+
+// dbHealthCheckStore 从数据库读写健康检查的数据
+type dbHealthCheckStore struct {
+	service *CookieService
+}
+
+func (s dbHealthCheckStore) CheckableCookies() ([]model.MorphCookie, error) {
+	var cookies []model.MorphCookie
+	err := s.service.GetDB().Scopes(notCoolingDown).Find(&cookies).Error
+	return cookies, err
+}
+
+func (s dbHealthCheckStore) PruneValidations(before time.Time) (int64, error) {
+	result := s.service.GetDB().
+		Where("created_at < ?", before).
+		Delete(&model.CookieValidation{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"opus-api/internal/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 可控时钟，After 的通道在 Advance 越过到期时间后触发
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	waited chan time.Duration // 每次调用 After 时发送等待时长
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local),
+		waited: make(chan time.Duration, 100),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	c.waited <- d
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.ch <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// stubChecker 记录验证过的 Cookie；block 不为空时验证会等到 block 关闭或 ctx 取消
+type stubChecker struct {
+	mu          sync.Mutex
+	checked     []uint
+	sources     []string
+	cancelled   int
+	inFlight    int
+	maxInFlight int
+	block       chan struct{}
+	started     chan uint
+}
+
+func (s *stubChecker) Validate(ctx context.Context, cookie *model.MorphCookie, source string) ValidationResult {
+	s.mu.Lock()
+	s.checked = append(s.checked, cookie.ID)
+	s.sources = append(s.sources, source)
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	if s.started != nil {
+		s.started <- cookie.ID
+	}
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if ctx.Err() != nil {
+		s.cancelled++
+	}
+	return ValidationResult{IsValid: true}
+}
+
+// stubHealthStore 返回固定的 Cookie 并记录清理验证历史的时间点
+type stubHealthStore struct {
+	mu      sync.Mutex
+	cookies []model.MorphCookie
+	loads   int
+	pruned  []time.Time
+}
+
+func (s *stubHealthStore) CheckableCookies() ([]model.MorphCookie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	return append([]model.MorphCookie(nil), s.cookies...), nil
+}
+
+func (s *stubHealthStore) PruneValidations(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruned = append(s.pruned, before)
+	return 0, nil
+}
+
+// newTestHealthChecker 创建使用可控时钟和桩验证器的健康检查器
+func newTestHealthChecker(checker cookieChecker, store healthCheckStore, clock *fakeClock) *HealthChecker {
+	return &HealthChecker{
+		validator:       checker,
+		store:           store,
+		interval:        30 * time.Minute,
+		invalidInterval: 6 * time.Hour,
+		concurrency:     4,
+		historyDays:     7,
+		done:            make(chan struct{}),
+		now:             clock.Now,
+		after:           clock.After,
+	}
+}
+
+// uncheckedCookies 创建 n 个从未验证过的 Cookie
+func uncheckedCookies(n int) []model.MorphCookie {
+	cookies := make([]model.MorphCookie, n)
+	for i := range cookies {
+		cookies[i] = model.MorphCookie{ID: uint(i + 1), IsValid: true}
+	}
+	return cookies
+}
+
+func TestHealthCheckerDueCookies(t *testing.T) {
+	clock := newFakeClock()
+	ago := func(d time.Duration) *time.Time {
+		at := clock.Now().Add(-d)
+		return &at
+	}
+	store := &stubHealthStore{cookies: []model.MorphCookie{
+		{ID: 1, IsValid: true, LastValidated: ago(10 * time.Minute)}, // 有效，未到期
+		{ID: 2, IsValid: true, LastValidated: ago(45 * time.Minute)}, // 有效，已到期
+		{ID: 3, IsValid: false, LastValidated: ago(time.Hour)},       // 失效，按更长的间隔未到期
+		{ID: 4, IsValid: false, LastValidated: ago(7 * time.Hour)},   // 失效，已到期
+		{ID: 5, IsValid: true}, // 从未验证
+	}}
+	h := newTestHealthChecker(&stubChecker{}, store, clock)
+
+	due, err := h.dueCookies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for _, cookie := range due {
+		ids = append(ids, cookie.ID)
+	}
+	// 从未验证的在前，其余按上次验证时间从早到晚
+	want := []uint{5, 4, 2}
+	if len(ids) != len(want) {
+		t.Fatalf("expected due cookies %v, got %v", want, ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("expected due cookies %v, got %v", want, ids)
+		}
+	}
+}
+
+func TestHealthCheckerJitter(t *testing.T) {
+	clock := newFakeClock()
+	checker := &stubChecker{}
+	h := newTestHealthChecker(checker, &stubHealthStore{cookies: uncheckedCookies(3)}, clock)
+	h.jitter = 30 * time.Second
+
+	done := make(chan struct{})
+	go func() {
+		h.runOnce(context.Background())
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		if d := <-clock.waited; d < 0 || d >= h.jitter {
+			t.Errorf("jitter delay %v out of [0, %v)", d, h.jitter)
+		}
+	}
+	checker.mu.Lock()
+	checked := len(checker.checked)
+	checker.mu.Unlock()
+	if checked != 0 {
+		t.Fatalf("expected no validation before the jitter delay, got %d", checked)
+	}
+
+	clock.Advance(h.jitter)
+	<-done
+	if len(checker.checked) != 3 {
+		t.Errorf("expected 3 validations after the jitter delay, got %d", len(checker.checked))
+	}
+}
+
+func TestHealthCheckerConcurrencyCap(t *testing.T) {
+	clock := newFakeClock()
+	checker := &stubChecker{block: make(chan struct{}), started: make(chan uint, 10)}
+	h := newTestHealthChecker(checker, &stubHealthStore{cookies: uncheckedCookies(5)}, clock)
+	h.concurrency = 2
+
+	done := make(chan struct{})
+	go func() {
+		h.runOnce(context.Background())
+		close(done)
+	}()
+
+	<-checker.started
+	<-checker.started
+	select {
+	case id := <-checker.started:
+		t.Fatalf("cookie %d started beyond the concurrency cap", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(checker.block)
+	<-done
+	if len(checker.checked) != 5 {
+		t.Errorf("expected 5 validations, got %d", len(checker.checked))
+	}
+	if checker.maxInFlight != 2 {
+		t.Errorf("expected at most 2 concurrent validations, got %d", checker.maxInFlight)
+	}
+}
+
+func TestHealthCheckerHistory(t *testing.T) {
+	clock := newFakeClock()
+	checker := &stubChecker{}
+	store := &stubHealthStore{cookies: uncheckedCookies(2)}
+	h := newTestHealthChecker(checker, store, clock)
+
+	h.runOnce(context.Background())
+
+	// 每次检测都以 scheduled 来源记录验证历史
+	for _, source := range checker.sources {
+		if source != model.ValidationSourceScheduled {
+			t.Errorf("expected source %q, got %q", model.ValidationSourceScheduled, source)
+		}
+	}
+	if len(checker.sources) != 2 {
+		t.Errorf("expected 2 validations, got %d", len(checker.sources))
+	}
+
+	// 检测结束后清理超过保留天数的历史
+	want := clock.Now().AddDate(0, 0, -h.historyDays)
+	if len(store.pruned) != 1 || !store.pruned[0].Equal(want) {
+		t.Errorf("expected history pruned before %v, got %v", want, store.pruned)
+	}
+}
+
+func TestHealthCheckerRescans(t *testing.T) {
+	clock := newFakeClock()
+	store := &stubHealthStore{}
+	h := newTestHealthChecker(&stubChecker{}, store, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.Start(ctx)
+
+	// 检测间隔大于扫描间隔时按扫描间隔查找到期的 Cookie
+	if d := <-clock.waited; d != healthCheckScanInterval {
+		t.Errorf("expected to wait %v between scans, got %v", healthCheckScanInterval, d)
+	}
+	clock.Advance(healthCheckScanInterval)
+	<-clock.waited
+
+	cancel()
+	h.Wait()
+	if store.loads != 2 {
+		t.Errorf("expected 2 scans, got %d", store.loads)
+	}
+}
+
+func TestHealthCheckerShutdown(t *testing.T) {
+	clock := newFakeClock()
+	checker := &stubChecker{block: make(chan struct{}), started: make(chan uint, 10)}
+	store := &stubHealthStore{cookies: uncheckedCookies(1)}
+	h := newTestHealthChecker(checker, store, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.Start(ctx)
+	<-checker.started
+
+	// 取消后正在进行的检测被中断，Wait 在其结束后返回
+	cancel()
+	waited := make(chan struct{})
+	go func() {
+		h.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the context was cancelled")
+	}
+
+	if checker.cancelled != 1 {
+		t.Errorf("expected the in-flight validation to see the cancellation, got %d", checker.cancelled)
+	}
+	if store.loads != 1 {
+		t.Errorf("expected no scan after shutdown, got %d", store.loads)
+	}
+}
+
+func TestHealthCheckerDisabled(t *testing.T) {
+	clock := newFakeClock()
+	store := &stubHealthStore{}
+	h := newTestHealthChecker(&stubChecker{}, store, clock)
+	h.interval = 0
+
+	h.Start(context.Background())
+	h.Wait()
+	if store.loads != 0 {
+		t.Errorf("expected no scans when disabled, got %d", store.loads)
+	}
+}
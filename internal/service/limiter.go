@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"opus-api/internal/model"
+	"sync"
+	"time"
+)
+
+// ErrCookieLimitReached 所有候选 Cookie 都达到了请求频率、每日 Token 或并发上限
+var ErrCookieLimitReached = errors.New("all cookies are at their rate limits")
+
+// CookieLoad Cookie 当前的负载（进程内统计，重启后清空）
+type CookieLoad struct {
+	InFlight    int   `json:"in_flight"`    // 进行中的请求数
+	TokensToday int64 `json:"tokens_today"` // 当天已使用的 Token 数
+}
+
+// limitState 单个 Cookie 的限流状态
+type limitState struct {
+	tokens      float64   // 令牌桶中剩余的请求数
+	refilledAt  time.Time // 上次补充令牌的时间
+	day         string    // tokensToday 所属的日期
+	tokensToday int64
+	inFlight    int
+}
+
+// CookieLimiter 在内存中按 Cookie 的 RPMLimit、DailyTokenLimit 和 MaxConcurrent 限流：
+// 每分钟请求数使用令牌桶，并发数使用计数信号量，Token 数按自然日累计。上限为 0 表示不限制
+type CookieLimiter struct {
+	mu     sync.Mutex
+	states map[uint]*limitState
+	now    func() time.Time
+}
+
+// NewCookieLimiter 创建限流器
+func NewCookieLimiter() *CookieLimiter {
+	return &CookieLimiter{
+		states: make(map[uint]*limitState),
+		now:    time.Now,
+	}
+}
+
+// state 获取 Cookie 的限流状态并补充令牌，调用方需持有锁
+func (l *CookieLimiter) state(cookie *model.MorphCookie) *limitState {
+	now := l.now()
+	s, ok := l.states[cookie.ID]
+	if !ok {
+		s = &limitState{tokens: float64(cookie.RPMLimit), refilledAt: now}
+		l.states[cookie.ID] = s
+	}
+
+	if cookie.RPMLimit > 0 {
+		capacity := float64(cookie.RPMLimit)
+		s.tokens += now.Sub(s.refilledAt).Minutes() * capacity
+		if s.tokens > capacity {
+			s.tokens = capacity
+		}
+	}
+	s.refilledAt = now
+
+	if day := now.Format("2006-01-02"); s.day != day {
+		s.day = day
+		s.tokensToday = 0
+	}
+	return s
+}
+
+// allowed Cookie 是否还有余量，调用方需持有锁
+func (l *CookieLimiter) allowed(cookie *model.MorphCookie) bool {
+	s := l.state(cookie)
+	if cookie.RPMLimit > 0 && s.tokens < 1 {
+		return false
+	}
+	if cookie.DailyTokenLimit > 0 && s.tokensToday >= cookie.DailyTokenLimit {
+		return false
+	}
+	if cookie.MaxConcurrent > 0 && s.inFlight >= cookie.MaxConcurrent {
+		return false
+	}
+	return true
+}
+
+// Allowed Cookie 是否还有余量，不占用额度
+func (l *CookieLimiter) Allowed(cookie *model.MorphCookie) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.allowed(cookie)
+}
+
+// Acquire 占用一次请求额度和一个并发名额，没有余量时返回 false。
+// 成功后必须调用 Release
+func (l *CookieLimiter) Acquire(cookie *model.MorphCookie) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.allowed(cookie) {
+		return false
+	}
+	s := l.states[cookie.ID]
+	if cookie.RPMLimit > 0 {
+		s.tokens--
+	}
+	s.inFlight++
+	return true
+}
+
+// Release 释放并发名额并累计本次请求使用的 Token 数
+func (l *CookieLimiter) Release(cookieID uint, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.states[cookieID]
+	if !ok {
+		return
+	}
+	if s.inFlight > 0 {
+		s.inFlight--
+	}
+	if tokens > 0 {
+		if day := l.now().Format("2006-01-02"); s.day != day {
+			s.day = day
+			s.tokensToday = 0
+		}
+		s.tokensToday += int64(tokens)
+	}
+}
+
+// Load 获取 Cookie 当前的负载
+func (l *CookieLimiter) Load(cookieID uint) CookieLoad {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.load(l.states[cookieID])
+}
+
+// Snapshot 获取所有有记录的 Cookie 当前的负载
+func (l *CookieLimiter) Snapshot() map[uint]CookieLoad {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := make(map[uint]CookieLoad, len(l.states))
+	for cookieID, s := range l.states {
+		snapshot[cookieID] = l.load(s)
+	}
+	return snapshot
+}
+
+// load 转换为 CookieLoad，跨日后的 Token 数视为 0，调用方需持有锁
+func (l *CookieLimiter) load(s *limitState) CookieLoad {
+	if s == nil {
+		return CookieLoad{}
+	}
+	load := CookieLoad{InFlight: s.inFlight, TokensToday: s.tokensToday}
+	if s.day != l.now().Format("2006-01-02") {
+		load.TokensToday = 0
+	}
+	return load
+}
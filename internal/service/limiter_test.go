@@ -0,0 +1,101 @@
+package service
+
+import (
+	"opus-api/internal/model"
+	"testing"
+	"time"
+)
+
+// newTestLimiter 创建使用可控时钟的限流器
+func newTestLimiter(now *time.Time) *CookieLimiter {
+	l := NewCookieLimiter()
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLimiterRPM(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	l := newTestLimiter(&now)
+	cookie := &model.MorphCookie{ID: 1, RPMLimit: 2}
+
+	for i := 0; i < 2; i++ {
+		if !l.Acquire(cookie) {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+		l.Release(cookie.ID, 0)
+	}
+	if l.Acquire(cookie) {
+		t.Fatal("third request within a minute should be limited")
+	}
+
+	// 2 RPM 每 30 秒补充一个令牌
+	now = now.Add(30 * time.Second)
+	if !l.Acquire(cookie) {
+		t.Fatal("request should be allowed after refill")
+	}
+	if l.Acquire(cookie) {
+		t.Fatal("only one token should have been refilled")
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	now := time.Now()
+	l := newTestLimiter(&now)
+	cookie := &model.MorphCookie{ID: 1, MaxConcurrent: 2}
+
+	if !l.Acquire(cookie) || !l.Acquire(cookie) {
+		t.Fatal("two concurrent requests should be allowed")
+	}
+	if l.Allowed(cookie) || l.Acquire(cookie) {
+		t.Fatal("third concurrent request should be limited")
+	}
+	if got := l.Load(cookie.ID).InFlight; got != 2 {
+		t.Errorf("InFlight = %d, want 2", got)
+	}
+
+	l.Release(cookie.ID, 0)
+	if !l.Acquire(cookie) {
+		t.Fatal("request should be allowed after release")
+	}
+}
+
+func TestLimiterDailyTokens(t *testing.T) {
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	l := newTestLimiter(&now)
+	cookie := &model.MorphCookie{ID: 1, DailyTokenLimit: 1000}
+
+	if !l.Acquire(cookie) {
+		t.Fatal("first request should be allowed")
+	}
+	l.Release(cookie.ID, 1200)
+	if l.Allowed(cookie) {
+		t.Fatal("request should be limited after exceeding the daily tokens")
+	}
+	if got := l.Snapshot()[cookie.ID].TokensToday; got != 1200 {
+		t.Errorf("TokensToday = %d, want 1200", got)
+	}
+
+	// 第二天重新计数
+	now = now.Add(2 * time.Hour)
+	if got := l.Load(cookie.ID).TokensToday; got != 0 {
+		t.Errorf("TokensToday after midnight = %d, want 0", got)
+	}
+	if !l.Allowed(cookie) {
+		t.Fatal("request should be allowed on the next day")
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	now := time.Now()
+	l := newTestLimiter(&now)
+	cookie := &model.MorphCookie{ID: 1}
+
+	for i := 0; i < 100; i++ {
+		if !l.Acquire(cookie) {
+			t.Fatalf("request %d should be allowed without limits", i+1)
+		}
+	}
+	if got := l.Load(cookie.ID).InFlight; got != 100 {
+		t.Errorf("InFlight = %d, want 100", got)
+	}
+}
@@ -2,136 +2,310 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"net/http"
 	"opus-api/internal/model"
+	"opus-api/internal/types"
+	"os"
+	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 )
 
-// RotationStrategy Cookie 轮询策略
-type RotationStrategy string
+// StrategySettingKey 持久化轮询策略使用的设置键
+const StrategySettingKey = "rotation_strategy"
+
+// DefaultMaxErrorCount 默认的 Cookie 连续失败阈值
+const DefaultMaxErrorCount = 3
 
 const (
-	StrategyRoundRobin RotationStrategy = "round_robin" // 轮询
-	StrategyPriority   RotationStrategy = "priority"    // 优先级
-	StrategyLeastUsed  RotationStrategy = "least_used"  // 最少使用
+	DefaultCooldownBase = 30 * time.Second // 第一次冷却的时长
+	DefaultCooldownMax  = 30 * time.Minute // 冷却时长上限
 )
 
+// maxErrorLength 保存的错误原因的最大长度（与 last_error 列一致）
+const maxErrorLength = 255
+
 var (
 	ErrNoCookiesAvailable = errors.New("no valid cookies available")
 )
 
 // CookieRotator Cookie 轮询器
 type CookieRotator struct {
-	service  *CookieService
-	strategy RotationStrategy
-	mu       sync.RWMutex
-	index    int // 用于 round_robin 策略
+	service       *CookieService
+	strategy      RotationStrategy
+	picker        Strategy
+	health        *CookieHealth
+	limiter       *CookieLimiter
+	affinity      *CookieAffinity
+	maxErrorCount int           // 连续失败达到该次数后标记为无效
+	cooldownBase  time.Duration // 第一次冷却的时长，之后每次翻倍
+	cooldownMax   time.Duration // 冷却时长上限
+	defaultPool   string        // 请求未指定池或指定的池没有可用 Cookie 时使用的池，为空时使用用户自己的和共享的 Cookie
+	mu            sync.RWMutex
 }
 
 // NewCookieRotator 创建轮询器
 func NewCookieRotator(service *CookieService, strategy RotationStrategy) *CookieRotator {
-	if strategy == "" {
+	if _, ok := strategyFactories[strategy]; !ok {
 		strategy = StrategyRoundRobin
 	}
-	return &CookieRotator{
-		service:  service,
-		strategy: strategy,
-		index:    0,
+	r := &CookieRotator{
+		service:       service,
+		health:        NewCookieHealth(),
+		limiter:       NewCookieLimiter(),
+		affinity:      NewCookieAffinity(optionalDurationFromEnv("SESSION_AFFINITY_TTL", DefaultAffinityTTL)),
+		maxErrorCount: maxErrorCountFromEnv(),
+		cooldownBase:  durationFromEnv("COOKIE_COOLDOWN_BASE", DefaultCooldownBase),
+		cooldownMax:   durationFromEnv("COOKIE_COOLDOWN_MAX", DefaultCooldownMax),
+		defaultPool:   os.Getenv("DEFAULT_COOKIE_POOL"),
+	}
+	r.SetStrategy(strategy)
+	return r
+}
+
+// maxErrorCountFromEnv 从 COOKIE_MAX_ERROR_COUNT 读取失败阈值
+func maxErrorCountFromEnv() int {
+	value := os.Getenv("COOKIE_MAX_ERROR_COUNT")
+	if value == "" {
+		return DefaultMaxErrorCount
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		log.Printf("[WARN] Invalid COOKIE_MAX_ERROR_COUNT %q, using %d", value, DefaultMaxErrorCount)
+		return DefaultMaxErrorCount
+	}
+	return count
+}
+
+// durationFromEnv 从环境变量读取时长（单位秒）
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		log.Printf("[WARN] Invalid %s %q, using %v", name, value, defaultValue)
+		return defaultValue
 	}
+	return time.Duration(seconds) * time.Second
 }
 
-// NextCookie 获取下一个可用的 Cookie
-func (r *CookieRotator) NextCookie() (interface{}, error) {
+// NextCookie 在 selector 指定的池范围内获取下一个可用的 Cookie，
+// 跳过 selector 中排除的和达到限流上限的 Cookie。指定了会话亲和键时优先使用会话绑定的 Cookie，
+// 绑定的 Cookie 不可用时改为绑定新选择的 Cookie。返回的 Cookie 占用一个限流名额，
+// 使用结束后必须调用 Release
+func (r *CookieRotator) NextCookie(selector types.CookieSelector) (interface{}, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	cookies, err := r.service.GetAllValidCookies()
+	if selector.Pool == "" && r.defaultPool != "" {
+		selector = inPool(selector, r.defaultPool)
+	}
+	limited := 0
+	cookies, scopeKey, err := r.candidates(selector, &limited)
 	if err != nil {
 		return nil, err
 	}
 
+	// 指定的池没有可用的 Cookie 时回退到默认池
+	if len(cookies) == 0 && r.canFallBack(selector) {
+		selector = inPool(selector, r.defaultPool)
+		if cookies, scopeKey, err = r.candidates(selector, &limited); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(cookies) == 0 {
+		if limited > 0 {
+			return nil, ErrCookieLimitReached
+		}
 		return nil, ErrNoCookiesAvailable
 	}
 
-	var selected *model.MorphCookie
-
-	switch r.strategy {
-	case StrategyRoundRobin:
-		selected = r.roundRobin(cookies)
-	case StrategyPriority:
-		selected = r.priority(cookies)
-	case StrategyLeastUsed:
-		selected = r.leastUsed(cookies)
-	default:
-		selected = r.roundRobin(cookies)
+	var (
+		selected    *model.MorphCookie
+		affinityKey string
+	)
+	if selector.AffinityKey != "" && r.affinity.Enabled() {
+		affinityKey = scopeKey + "|" + selector.AffinityKey
+		selected = r.boundCookie(affinityKey, cookies)
+	}
+	if selected == nil {
+		selected = r.picker.Pick(scopeKey, cookies)
 	}
-
 	if selected == nil {
 		return nil, ErrNoCookiesAvailable
 	}
+	// 所有 Acquire 都在 r.mu 内进行，筛选后不会被其他请求抢占
+	if !r.limiter.Acquire(selected) {
+		return nil, ErrCookieLimitReached
+	}
+	if affinityKey != "" {
+		r.affinity.Bind(affinityKey, selected.ID)
+	}
 
 	return selected, nil
 }
 
-// roundRobin 轮询策略
-func (r *CookieRotator) roundRobin(cookies []model.MorphCookie) *model.MorphCookie {
-	if len(cookies) == 0 {
-		return nil
+// canFallBack 判断 selector 的池没有可用的 Cookie 时能否回退到默认池。
+// API Key 绑定的池不回退，否则请求会用到绑定的池以外的 Cookie
+func (r *CookieRotator) canFallBack(selector types.CookieSelector) bool {
+	return r.defaultPool != "" && selector.Pool != r.defaultPool && !selector.PoolBound
+}
+
+// inPool 把 selector 限定在指定名称的池中，只使用自己 Cookie 的请求仍只使用自己在该池中的 Cookie
+func inPool(selector types.CookieSelector, pool string) types.CookieSelector {
+	selector.Pool = pool
+	if selector.Scope != types.PoolScopeUser {
+		selector.Scope = types.PoolScopeGroup
 	}
+	return selector
+}
 
-	r.index = r.index % len(cookies)
-	selected := &cookies[r.index]
-	r.index++
+// boundCookie 获取会话绑定的 Cookie，未绑定或绑定的 Cookie 不在候选中（失效、冷却、限流或本次请求已失败）时返回 nil
+func (r *CookieRotator) boundCookie(affinityKey string, cookies []model.MorphCookie) *model.MorphCookie {
+	cookieID, ok := r.affinity.Lookup(affinityKey)
+	if !ok {
+		return nil
+	}
+	for i := range cookies {
+		if cookies[i].ID == cookieID {
+			return &cookies[i]
+		}
+	}
+	log.Printf("[INFO] Session cookie (ID: %d) is unavailable, moving session to another cookie", cookieID)
+	return nil
+}
 
-	return selected
+// Release 释放 NextCookie 占用的限流名额，tokens 为本次请求使用的 Token 数
+func (r *CookieRotator) Release(cookieID uint, tokens int) {
+	r.limiter.Release(cookieID, tokens)
 }
 
-// priority 优先级策略（优先级高的优先使用）
-func (r *CookieRotator) priority(cookies []model.MorphCookie) *model.MorphCookie {
-	if len(cookies) == 0 {
-		return nil
+// candidates 获取池范围内未被排除且未达到限流上限的有效 Cookie，并返回实际使用的范围标识。
+// 因限流被跳过的 Cookie 数累加到 limited
+func (r *CookieRotator) candidates(selector types.CookieSelector, limited *int) ([]model.MorphCookie, string, error) {
+	var (
+		cookies  []model.MorphCookie
+		scopeKey string
+		err      error
+	)
+	switch selector.Scope {
+	case types.PoolScopeUser:
+		cookies, err = r.service.GetValidCookies(selector.UserID)
+		scopeKey = fmt.Sprintf("user:%d", selector.UserID)
+		if selector.Pool != "" {
+			cookies = filterPool(cookies, selector.Pool)
+			scopeKey += "/" + selector.Pool
+		}
+	case types.PoolScopeShared:
+		cookies, err = r.service.GetSharedValidCookies()
+		scopeKey = "shared"
+	case types.PoolScopeGroup:
+		cookies, err = r.service.GetPoolValidCookies(selector.Pool, selector.UserID)
+		scopeKey = "group:" + selector.Pool
+	default:
+		// 默认：优先使用用户自己的 Cookie，没有可用的时使用共享池
+		if selector.UserID != 0 {
+			userSelector := selector
+			userSelector.Scope = types.PoolScopeUser
+			cookies, scopeKey, err := r.candidates(userSelector, limited)
+			if err != nil || len(cookies) > 0 {
+				return cookies, scopeKey, err
+			}
+		}
+		sharedSelector := selector
+		sharedSelector.Scope = types.PoolScopeShared
+		return r.candidates(sharedSelector, limited)
 	}
 
-	// cookies 已经按照 priority DESC 排序
-	return &cookies[0]
+	cookies = excludeCookies(cookies, selector.ExcludeIDs)
+	cookies = r.filterLimited(cookies, limited)
+	return cookies, scopeKey, err
 }
 
-// leastUsed 最少使用策略
-func (r *CookieRotator) leastUsed(cookies []model.MorphCookie) *model.MorphCookie {
-	if len(cookies) == 0 {
-		return nil
+// filterPool 只保留指定池中的 Cookie
+func filterPool(cookies []model.MorphCookie, pool string) []model.MorphCookie {
+	filtered := make([]model.MorphCookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		if cookie.Pool == pool {
+			filtered = append(filtered, cookie)
+		}
 	}
+	return filtered
+}
+
+// filterLimited 过滤掉达到限流上限的 Cookie，并累加被过滤的数量
+func (r *CookieRotator) filterLimited(cookies []model.MorphCookie, limited *int) []model.MorphCookie {
+	filtered := make([]model.MorphCookie, 0, len(cookies))
+	for i := range cookies {
+		if r.limiter.Allowed(&cookies[i]) {
+			filtered = append(filtered, cookies[i])
+		} else {
+			*limited++
+		}
+	}
+	return filtered
+}
 
-	// cookies 已经按照 usage_count ASC 排序
-	return &cookies[0]
+// excludeCookies 过滤掉指定 ID 的 Cookie
+func excludeCookies(cookies []model.MorphCookie, excludeIDs []uint) []model.MorphCookie {
+	if len(excludeIDs) == 0 {
+		return cookies
+	}
+	excluded := make(map[uint]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
+	filtered := make([]model.MorphCookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		if !excluded[cookie.ID] {
+			filtered = append(filtered, cookie)
+		}
+	}
+	return filtered
 }
 
-// MarkUsed 标记 Cookie 已使用
-func (r *CookieRotator) MarkUsed(cookieID uint) error {
+// MarkUsed 标记 Cookie 已使用（成功使用后重置错误计数和冷却），ttfb 为上游首字节延迟
+func (r *CookieRotator) MarkUsed(cookieID uint, ttfb time.Duration) error {
+	r.health.RecordSuccess(cookieID, ttfb)
 	db := r.service.GetDB()
 	return db.Model(&model.MorphCookie{}).
 		Where("id = ?", cookieID).
 		Updates(map[string]interface{}{
-			"usage_count": gorm.Expr("usage_count + ?", 1),
-			"last_used":   time.Now(),
+			"usage_count":    gorm.Expr("usage_count + ?", 1),
+			"last_used":      time.Now(),
+			"error_count":    0,
+			"cooldown_until": nil,
+			"cooldown_count": 0,
 		}).Error
 }
 
-// MarkInvalid 标记 Cookie 无效
-func (r *CookieRotator) MarkInvalid(cookieID uint) error {
+// MarkInvalid 标记 Cookie 无效（上游拒绝了 Cookie 本身）
+func (r *CookieRotator) MarkInvalid(cookieID uint, reason string) error {
+	r.health.RecordError(cookieID)
 	db := r.service.GetDB()
 	return db.Model(&model.MorphCookie{}).
 		Where("id = ?", cookieID).
 		Updates(map[string]interface{}{
-			"is_valid": false,
+			"is_valid":      false,
+			"last_error":    truncateError(reason),
+			"last_error_at": time.Now(),
 		}).Error
 }
 
-// MarkError 标记 Cookie 错误
-func (r *CookieRotator) MarkError(cookieID uint) error {
+// MarkError 标记 Cookie 错误。statusCode 为 0 表示没有收到响应。
+// 429、5xx 和网络错误通常是暂时的，Cookie 进入冷却，冷却时长随连续冷却次数指数增长；
+// 说明账号有问题的错误（401/402/403）累计 error_count，达到阈值后标记为无效；
+// 其他错误（如请求格式错误）与账号无关，只记录错误信息
+func (r *CookieRotator) MarkError(cookieID uint, statusCode int, reason string) error {
+	r.health.RecordError(cookieID)
 	db := r.service.GetDB()
 
 	var cookie model.MorphCookie
@@ -139,22 +313,77 @@ func (r *CookieRotator) MarkError(cookieID uint) error {
 		return err
 	}
 
+	return db.Model(&model.MorphCookie{}).
+		Where("id = ?", cookieID).
+		Updates(r.errorUpdates(&cookie, statusCode, reason, time.Now())).Error
+}
+
+// errorUpdates 计算一次上游错误对 Cookie 的更新，cookie 为更新前的状态
+func (r *CookieRotator) errorUpdates(cookie *model.MorphCookie, statusCode int, reason string, now time.Time) map[string]interface{} {
 	updates := map[string]interface{}{
-		"error_count": gorm.Expr("error_count + ?", 1),
+		"last_error":    truncateError(reason),
+		"last_error_at": now,
 	}
 
-	// 如果错误次数超过阈值，标记为无效
-	if cookie.ErrorCount >= 5 {
-		updates["is_valid"] = false
+	if isTransientStatus(statusCode) {
+		cooldown := r.cooldownDuration(cookie.CooldownCount)
+		updates["cooldown_until"] = now.Add(cooldown)
+		updates["cooldown_count"] = gorm.Expr("cooldown_count + ?", 1)
+		log.Printf("[INFO] Cookie (ID: %d) cooling down for %v: %s", cookie.ID, cooldown, reason)
+	} else if isAccountStatus(statusCode) {
+		updates["error_count"] = gorm.Expr("error_count + ?", 1)
+		// 如果错误次数达到阈值，标记为无效
+		if cookie.ErrorCount+1 >= r.maxErrorCount {
+			log.Printf("[WARN] Cookie (ID: %d) reached %d errors, marking invalid", cookie.ID, r.maxErrorCount)
+			updates["is_valid"] = false
+		}
 	}
+	return updates
+}
 
-	return db.Model(&model.MorphCookie{}).
-		Where("id = ?", cookieID).
-		Updates(updates).Error
+// isTransientStatus 判断上游错误是否是暂时的（限流、服务端错误、网络错误）
+func isTransientStatus(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// isAccountStatus 判断上游错误是否说明账号有问题（未授权、欠费、被禁止）
+func isAccountStatus(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusPaymentRequired || statusCode == http.StatusForbidden
+}
+
+// cooldownDuration 第 n+1 次连续冷却的时长：cooldownBase * 2^n，不超过 cooldownMax
+func (r *CookieRotator) cooldownDuration(previousCooldowns int) time.Duration {
+	cooldown := r.cooldownBase
+	for i := 0; i < previousCooldowns && cooldown < r.cooldownMax; i++ {
+		cooldown *= 2
+	}
+	if cooldown > r.cooldownMax {
+		cooldown = r.cooldownMax
+	}
+	return cooldown
+}
+
+// truncateError 截断错误原因以适应 last_error 列
+func truncateError(reason string) string {
+	return truncateString(reason, maxErrorLength)
+}
+
+// truncateString 按字节数截断字符串，避免截断到多字节字符的中间
+func truncateString(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	cut := maxLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
 }
 
 // GetStrategy 获取当前策略
 func (r *CookieRotator) GetStrategy() RotationStrategy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.strategy
 }
 
@@ -163,5 +392,51 @@ func (r *CookieRotator) SetStrategy(strategy RotationStrategy) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.strategy = strategy
-	r.index = 0 // 重置索引
-}
\ No newline at end of file
+	r.picker = strategyFactories[strategy](r) // 新实例，重置策略状态
+}
+
+// Health 获取 Cookie 近期的延迟和错误率记录
+func (r *CookieRotator) Health() *CookieHealth {
+	return r.health
+}
+
+// Limiter 获取 Cookie 限流器
+func (r *CookieRotator) Limiter() *CookieLimiter {
+	return r.limiter
+}
+
+// LoadStrategy 启动时加载轮询策略：优先使用通过接口保存的策略，
+// 其次使用 ROTATION_STRATEGY 环境变量
+func (r *CookieRotator) LoadStrategy() {
+	saved, ok, err := model.GetSetting(r.service.GetDB(), StrategySettingKey)
+	if err != nil {
+		log.Printf("[WARN] Failed to load saved rotation strategy: %v", err)
+	}
+	if ok {
+		if strategy, err := ParseStrategy(saved); err == nil {
+			r.SetStrategy(strategy)
+			log.Printf("[INFO] Rotation strategy: %s (saved)", strategy)
+			return
+		}
+		log.Printf("[WARN] Ignoring invalid saved rotation strategy %q", saved)
+	}
+
+	if value := os.Getenv("ROTATION_STRATEGY"); value != "" {
+		strategy, err := ParseStrategy(value)
+		if err != nil {
+			log.Printf("[WARN] Invalid ROTATION_STRATEGY: %v, using %s", err, r.GetStrategy())
+			return
+		}
+		r.SetStrategy(strategy)
+	}
+	log.Printf("[INFO] Rotation strategy: %s", r.GetStrategy())
+}
+
+// SaveStrategy 设置轮询策略并持久化，重启后仍然生效
+func (r *CookieRotator) SaveStrategy(strategy RotationStrategy) error {
+	if err := model.SaveSetting(r.service.GetDB(), StrategySettingKey, string(strategy)); err != nil {
+		return err
+	}
+	r.SetStrategy(strategy)
+	return nil
+}
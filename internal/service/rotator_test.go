@@ -0,0 +1,174 @@
+package service
+
+import (
+	"opus-api/internal/model"
+	"opus-api/internal/types"
+	"testing"
+	"time"
+)
+
+func TestCooldownDuration(t *testing.T) {
+	r := &CookieRotator{cooldownBase: 30 * time.Second, cooldownMax: 5 * time.Minute}
+
+	tests := []struct {
+		previous int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := r.cooldownDuration(tt.previous); got != tt.want {
+			t.Errorf("cooldownDuration(%d) = %v, want %v", tt.previous, got, tt.want)
+		}
+	}
+}
+
+func TestIsTransientStatus(t *testing.T) {
+	for _, status := range []int{0, 429, 500, 503, 529} {
+		if !isTransientStatus(status) {
+			t.Errorf("status %d should be transient", status)
+		}
+	}
+	for _, status := range []int{400, 404, 422} {
+		if isTransientStatus(status) {
+			t.Errorf("status %d should not be transient", status)
+		}
+	}
+}
+
+func TestIsAccountStatus(t *testing.T) {
+	for _, status := range []int{401, 402, 403} {
+		if !isAccountStatus(status) {
+			t.Errorf("status %d should count towards invalidation", status)
+		}
+	}
+	for _, status := range []int{0, 400, 404, 413, 422, 429, 500} {
+		if isAccountStatus(status) {
+			t.Errorf("status %d should not count towards invalidation", status)
+		}
+	}
+}
+
+func TestErrorUpdates(t *testing.T) {
+	r := &CookieRotator{maxErrorCount: 3, cooldownBase: 30 * time.Second, cooldownMax: 5 * time.Minute}
+	now := time.Now()
+
+	// Account errors count towards the threshold and invalidate the cookie on reaching it
+	for errorCount := 0; errorCount < 3; errorCount++ {
+		updates := r.errorUpdates(&model.MorphCookie{ID: 1, ErrorCount: errorCount}, 403, "forbidden", now)
+		if _, ok := updates["error_count"]; !ok {
+			t.Errorf("error %d: expected error_count to be incremented", errorCount+1)
+		}
+		_, invalidated := updates["is_valid"]
+		if want := errorCount+1 >= 3; invalidated != want {
+			t.Errorf("error %d: invalidated = %v, want %v", errorCount+1, invalidated, want)
+		}
+	}
+
+	// Transient errors cool the cookie down without counting
+	updates := r.errorUpdates(&model.MorphCookie{ID: 1, ErrorCount: 2}, 429, "rate limited", now)
+	if _, ok := updates["error_count"]; ok {
+		t.Error("429 should not count towards the threshold")
+	}
+	if until, ok := updates["cooldown_until"].(time.Time); !ok || !until.Equal(now.Add(30*time.Second)) {
+		t.Errorf("expected a 30s cooldown, got %v", updates["cooldown_until"])
+	}
+
+	// Other errors only record the reason
+	updates = r.errorUpdates(&model.MorphCookie{ID: 1, ErrorCount: 2}, 400, "bad request", now)
+	if len(updates) != 2 || updates["last_error"] != "bad request" {
+		t.Errorf("expected only the last error to be recorded, got %v", updates)
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	if got := truncateString("hello", 10); got != "hello" {
+		t.Errorf("short string changed: %q", got)
+	}
+	if got := truncateString("hello world", 5); got != "hello" {
+		t.Errorf("truncateString = %q, want %q", got, "hello")
+	}
+	// "你" is three bytes; never split it
+	if got := truncateString("a你好", 3); got != "a" {
+		t.Errorf("truncateString split a rune: %q", got)
+	}
+}
+
+func TestFilterPool(t *testing.T) {
+	cookies := []model.MorphCookie{
+		{ID: 1, Pool: "team"},
+		{ID: 2, Pool: model.DefaultPool},
+		{ID: 3, Pool: "team"},
+	}
+
+	got := filterPool(cookies, "team")
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 3 {
+		t.Errorf("filterPool(team) = %+v", got)
+	}
+	if got := filterPool(cookies, "missing"); len(got) != 0 {
+		t.Errorf("unknown pool returned %d cookies", len(got))
+	}
+}
+
+func TestCanFallBack(t *testing.T) {
+	r := &CookieRotator{defaultPool: "production"}
+	tests := []struct {
+		selector types.CookieSelector
+		want     bool
+	}{
+		{types.CookieSelector{Pool: "experiment"}, true},
+		{types.CookieSelector{Pool: "production"}, false},
+		// A pool bound to the API key never spills into the default pool
+		{types.CookieSelector{Pool: "experiment", PoolBound: true}, false},
+	}
+	for _, tt := range tests {
+		if got := r.canFallBack(tt.selector); got != tt.want {
+			t.Errorf("canFallBack(%+v) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+
+	// Without a default pool there is nothing to fall back to
+	r.defaultPool = ""
+	if r.canFallBack(types.CookieSelector{Pool: "experiment"}) {
+		t.Error("expected no fallback without a default pool")
+	}
+}
+
+func TestInPool(t *testing.T) {
+	if got := inPool(types.CookieSelector{UserID: 1}, "production"); got.Scope != types.PoolScopeGroup || got.Pool != "production" {
+		t.Errorf("inPool = %+v, want the production pool", got)
+	}
+	// Requests limited to their own cookies stay limited within the pool
+	if got := inPool(types.CookieSelector{UserID: 1, Scope: types.PoolScopeUser}, "production"); got.Scope != types.PoolScopeUser || got.Pool != "production" {
+		t.Errorf("inPool = %+v, want the user's cookies in the production pool", got)
+	}
+}
+
+func TestFilterLimited(t *testing.T) {
+	r := &CookieRotator{limiter: NewCookieLimiter()}
+	busy := &model.MorphCookie{ID: 1, MaxConcurrent: 1}
+	if !r.limiter.Acquire(busy) {
+		t.Fatal("first request should be allowed")
+	}
+
+	cookies := []model.MorphCookie{*busy, {ID: 2, MaxConcurrent: 1}, {ID: 3}}
+	limited := 0
+	got := r.filterLimited(cookies, &limited)
+	if len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+		t.Errorf("filterLimited = %+v", got)
+	}
+	if limited != 1 {
+		t.Errorf("limited = %d, want 1", limited)
+	}
+
+	r.Release(busy.ID, 0)
+	limited = 0
+	if got := r.filterLimited(cookies, &limited); len(got) != 3 || limited != 0 {
+		t.Errorf("after release: %d cookies, %d limited", len(got), limited)
+	}
+}
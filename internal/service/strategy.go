@@ -0,0 +1,182 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"opus-api/internal/model"
+	"time"
+)
+
+// RotationStrategy Cookie 轮询策略
+type RotationStrategy string
+
+const (
+	StrategyRoundRobin RotationStrategy = "round_robin" // 轮询
+	StrategyPriority   RotationStrategy = "priority"    // 优先级
+	StrategyLeastUsed  RotationStrategy = "least_used"  // 最少使用
+	StrategyWeighted   RotationStrategy = "weighted"    // 按优先级加权轮询
+	StrategyFastest    RotationStrategy = "fastest"     // 延迟最低、错误率最低优先
+)
+
+// Strategy 从候选 Cookie 中选出一个。
+// candidates 按 priority DESC, usage_count ASC 排序且不为空；scopeKey 标识池范围，
+// 有状态的策略按范围分别维护状态。调用方持有轮询器的锁，实现无需自行加锁。
+type Strategy interface {
+	Pick(scopeKey string, candidates []model.MorphCookie) *model.MorphCookie
+}
+
+// StrategyFactory 创建策略实例，每次切换策略时都会创建新的实例
+type StrategyFactory func(rotator *CookieRotator) Strategy
+
+var (
+	strategyFactories = make(map[RotationStrategy]StrategyFactory)
+	strategyOrder     []RotationStrategy
+)
+
+// RegisterStrategy 注册轮询策略
+func RegisterStrategy(name RotationStrategy, factory StrategyFactory) {
+	if _, exists := strategyFactories[name]; !exists {
+		strategyOrder = append(strategyOrder, name)
+	}
+	strategyFactories[name] = factory
+}
+
+// AvailableStrategies 所有已注册的轮询策略
+func AvailableStrategies() []RotationStrategy {
+	return append([]RotationStrategy(nil), strategyOrder...)
+}
+
+// ParseStrategy 解析轮询策略名称
+func ParseStrategy(value string) (RotationStrategy, error) {
+	strategy := RotationStrategy(value)
+	if _, ok := strategyFactories[strategy]; !ok {
+		return "", fmt.Errorf("unknown rotation strategy %q, supported: %v", value, strategyOrder)
+	}
+	return strategy, nil
+}
+
+func init() {
+	RegisterStrategy(StrategyRoundRobin, func(*CookieRotator) Strategy {
+		return &roundRobinStrategy{indexes: make(map[string]int)}
+	})
+	RegisterStrategy(StrategyPriority, func(*CookieRotator) Strategy {
+		return priorityStrategy{}
+	})
+	RegisterStrategy(StrategyLeastUsed, func(*CookieRotator) Strategy {
+		return leastUsedStrategy{}
+	})
+	RegisterStrategy(StrategyWeighted, func(*CookieRotator) Strategy {
+		return &weightedStrategy{current: make(map[string]map[uint]int)}
+	})
+	RegisterStrategy(StrategyFastest, func(r *CookieRotator) Strategy {
+		return fastestStrategy{health: r.health, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	})
+}
+
+// roundRobinStrategy 轮询策略，每个池范围独立计数
+type roundRobinStrategy struct {
+	indexes map[string]int
+}
+
+func (s *roundRobinStrategy) Pick(scopeKey string, candidates []model.MorphCookie) *model.MorphCookie {
+	index := s.indexes[scopeKey] % len(candidates)
+	s.indexes[scopeKey] = index + 1
+	return &candidates[index]
+}
+
+// priorityStrategy 优先级策略（优先级高的优先使用）
+type priorityStrategy struct{}
+
+func (priorityStrategy) Pick(_ string, candidates []model.MorphCookie) *model.MorphCookie {
+	// candidates 已经按照 priority DESC 排序
+	return &candidates[0]
+}
+
+// leastUsedStrategy 最少使用策略，使用次数相同时选择最久未使用的
+type leastUsedStrategy struct{}
+
+func (leastUsedStrategy) Pick(_ string, candidates []model.MorphCookie) *model.MorphCookie {
+	best := &candidates[0]
+	for i := 1; i < len(candidates); i++ {
+		c := &candidates[i]
+		if c.UsageCount < best.UsageCount ||
+			(c.UsageCount == best.UsageCount && usedBefore(c, best)) {
+			best = c
+		}
+	}
+	return best
+}
+
+// usedBefore 判断 a 是否比 b 更久未使用（从未使用的最优先）
+func usedBefore(a, b *model.MorphCookie) bool {
+	if a.LastUsed == nil {
+		return b.LastUsed != nil
+	}
+	return b.LastUsed != nil && a.LastUsed.Before(*b.LastUsed)
+}
+
+// weightedStrategy 平滑加权轮询（与 nginx 相同的算法），以 Priority 为权重，
+// 权重小于 1 的按 1 计算。每个池范围独立维护当前权重。
+type weightedStrategy struct {
+	current map[string]map[uint]int
+}
+
+func (s *weightedStrategy) Pick(scopeKey string, candidates []model.MorphCookie) *model.MorphCookie {
+	previous := s.current[scopeKey]
+	// 只保留仍在候选中的 Cookie，被移除的 Cookie 不再影响权重
+	current := make(map[uint]int, len(candidates))
+
+	total := 0
+	var best *model.MorphCookie
+	for i := range candidates {
+		c := &candidates[i]
+		weight := cookieWeight(c)
+		total += weight
+		current[c.ID] = previous[c.ID] + weight
+		if best == nil || current[c.ID] > current[best.ID] {
+			best = c
+		}
+	}
+	current[best.ID] -= total
+	s.current[scopeKey] = current
+	return best
+}
+
+// cookieWeight 加权轮询使用的权重
+func cookieWeight(c *model.MorphCookie) int {
+	if c.Priority < 1 {
+		return 1
+	}
+	return c.Priority
+}
+
+// fastestExploreRate fastest 策略随机选择 Cookie 的概率，使评分较差的 Cookie 也能得到新的样本
+const fastestExploreRate = 0.1
+
+// fastestStrategy 选择近期首字节延迟最低、错误率最低的 Cookie；
+// 没有样本的 Cookie 优先，以便收集数据。另有 fastestExploreRate 的概率随机选择，
+// 避免所有流量都集中在一个 Cookie 上、其他 Cookie 的样本一直得不到更新
+type fastestStrategy struct {
+	health *CookieHealth
+	rand   *rand.Rand // 调用方持有轮询器的锁，无需并发安全
+}
+
+func (s fastestStrategy) Pick(_ string, candidates []model.MorphCookie) *model.MorphCookie {
+	if len(candidates) > 1 && s.rand.Float64() < fastestExploreRate {
+		return &candidates[s.rand.Intn(len(candidates))]
+	}
+
+	var best *model.MorphCookie
+	bestScore := 0.0
+	for i := range candidates {
+		c := &candidates[i]
+		score, ok := s.health.Score(c.ID)
+		if !ok {
+			return c
+		}
+		if best == nil || score < bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"math/rand"
+	"opus-api/internal/model"
+	"testing"
+	"time"
+)
+
+func TestWeightedStrategy(t *testing.T) {
+	strategy := &weightedStrategy{current: make(map[string]map[uint]int)}
+	cookies := []model.MorphCookie{
+		{ID: 1, Priority: 5},
+		{ID: 2, Priority: 1},
+		{ID: 3, Priority: 1},
+	}
+
+	counts := make(map[uint]int)
+	var sequence []uint
+	for i := 0; i < 7; i++ {
+		picked := strategy.Pick("shared", cookies)
+		counts[picked.ID]++
+		sequence = append(sequence, picked.ID)
+	}
+
+	if counts[1] != 5 || counts[2] != 1 || counts[3] != 1 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+	// Smooth: the heavy cookie is never picked for the whole window in a row
+	want := []uint{1, 1, 2, 1, 3, 1, 1}
+	for i := range want {
+		if sequence[i] != want[i] {
+			t.Fatalf("sequence = %v, want %v", sequence, want)
+		}
+	}
+}
+
+func TestWeightedStrategyZeroPriority(t *testing.T) {
+	strategy := &weightedStrategy{current: make(map[string]map[uint]int)}
+	cookies := []model.MorphCookie{{ID: 1}, {ID: 2}}
+
+	first := strategy.Pick("shared", cookies)
+	second := strategy.Pick("shared", cookies)
+	if first.ID == second.ID {
+		t.Errorf("zero priorities should alternate, got %d twice", first.ID)
+	}
+}
+
+// fixedSource is a rand.Source that always returns the same value
+type fixedSource int64
+
+func (s fixedSource) Int63() int64 { return int64(s) }
+func (fixedSource) Seed(int64)     {}
+
+// noExplore makes fastestStrategy always pick by score
+var noExplore = rand.New(fixedSource(1 << 62))
+
+func TestFastestStrategy(t *testing.T) {
+	health := NewCookieHealth()
+	strategy := fastestStrategy{health: health, rand: noExplore}
+	cookies := []model.MorphCookie{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	health.RecordSuccess(1, 800*time.Millisecond)
+	health.RecordSuccess(2, 200*time.Millisecond)
+
+	// Cookie 3 has no samples yet and is tried first
+	if picked := strategy.Pick("shared", cookies); picked.ID != 3 {
+		t.Fatalf("expected unsampled cookie 3, got %d", picked.ID)
+	}
+
+	health.RecordSuccess(3, 100*time.Millisecond)
+	health.RecordError(3)
+	health.RecordError(3)
+
+	if picked := strategy.Pick("shared", cookies); picked.ID != 2 {
+		t.Errorf("expected fast healthy cookie 2, got %d", picked.ID)
+	}
+}
+
+func TestFastestStrategyExplores(t *testing.T) {
+	health := NewCookieHealth()
+	cookies := []model.MorphCookie{{ID: 1}, {ID: 2}}
+	health.RecordError(1)
+	health.RecordSuccess(2, 100*time.Millisecond)
+
+	// A draw below fastestExploreRate picks a random cookie, even a failing one
+	strategy := fastestStrategy{health: health, rand: rand.New(fixedSource(0))}
+	if picked := strategy.Pick("shared", cookies); picked.ID != 1 {
+		t.Errorf("expected exploration to pick cookie 1, got %d", picked.ID)
+	}
+
+	strategy = fastestStrategy{health: health, rand: rand.New(rand.NewSource(1))}
+	picks := make(map[uint]int)
+	for i := 0; i < 1000; i++ {
+		picks[strategy.Pick("shared", cookies).ID]++
+	}
+	if picks[1] == 0 || picks[1] > 150 {
+		t.Errorf("expected the failing cookie to be explored occasionally, got %v", picks)
+	}
+}
+
+func TestCookieHealthSamplesExpire(t *testing.T) {
+	health := NewCookieHealth()
+	now := time.Now()
+	health.now = func() time.Time { return now }
+
+	health.RecordError(1)
+	health.RecordError(1)
+	if stats := health.Stats(1); stats.Samples != 2 || stats.ErrorRate != 1 {
+		t.Fatalf("expected 2 failed samples, got %+v", stats)
+	}
+
+	now = now.Add(healthSampleTTL / 2)
+	health.RecordSuccess(1, 100*time.Millisecond)
+
+	// The errors expire and only the later success counts
+	now = now.Add(healthSampleTTL/2 + time.Second)
+	if stats := health.Stats(1); stats.Samples != 1 || stats.ErrorRate != 0 {
+		t.Errorf("expected only the recent success, got %+v", stats)
+	}
+
+	// Once every sample expired the cookie is unsampled again
+	now = now.Add(healthSampleTTL)
+	if _, ok := health.Score(1); ok {
+		t.Error("expected no score after all samples expired")
+	}
+	if _, ok := health.Snapshot()[1]; ok {
+		t.Error("expected the expired cookie to be left out of the snapshot")
+	}
+}
+
+func TestLeastUsedStrategy(t *testing.T) {
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+	cookies := []model.MorphCookie{
+		{ID: 1, Priority: 10, UsageCount: 50},
+		{ID: 2, UsageCount: 3, LastUsed: &later},
+		{ID: 3, UsageCount: 3, LastUsed: &earlier},
+	}
+
+	if picked := (leastUsedStrategy{}).Pick("shared", cookies); picked.ID != 3 {
+		t.Errorf("expected least recently used cookie 3, got %d", picked.ID)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for _, name := range []string{"round_robin", "priority", "least_used", "weighted", "fastest"} {
+		if _, err := ParseStrategy(name); err != nil {
+			t.Errorf("ParseStrategy(%q): %v", name, err)
+		}
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"opus-api/internal/model"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 批量验证默认配置
+const (
+	DefaultValidationConcurrency = 5
+
+	// jobRetention 任务结束后保留的时长，期间仍可以查看结果
+	jobRetention = 10 * time.Minute
+)
+
+// 任务事件类型
+const (
+	JobEventResult = "result" // 单个 Cookie 的验证结果
+	JobEventDone   = "done"   // 所有 Cookie 验证完成
+)
+
+// ErrJobNotFound 任务不存在或已过期
+var ErrJobNotFound = errors.New("job not found")
+
+// JobEvent 任务进度事件
+type JobEvent struct {
+	Type       string `json:"type"`
+	CookieID   uint   `json:"cookie_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	IsValid    bool   `json:"is_valid"`
+	Transient  bool   `json:"transient,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	LatencyMs  int64  `json:"latency_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Completed  int    `json:"completed"`
+	Total      int    `json:"total"`
+	ValidCount int    `json:"valid_count"`
+	Cancelled  bool   `json:"cancelled,omitempty"` // 服务关闭，任务未完成
+}
+
+// ValidationJob 批量验证任务，事件按顺序保存，订阅者可以从任意位置开始读取
+type ValidationJob struct {
+	ID        string
+	UserID    uint
+	Total     int
+	CreatedAt time.Time
+
+	mu      sync.Mutex
+	events  []JobEvent
+	done    bool
+	changed chan struct{} // 有新事件时关闭并替换
+}
+
+// Events 返回 from 之后的事件；没有新事件时返回的 channel 在下一次更新时关闭
+func (j *ValidationJob) Events(from int) ([]JobEvent, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if from > len(j.events) {
+		from = len(j.events)
+	}
+	events := append([]JobEvent(nil), j.events[from:]...)
+	return events, j.done, j.changed
+}
+
+// publish 追加事件并通知订阅者
+func (j *ValidationJob) publish(event JobEvent, done bool) {
+	j.mu.Lock()
+	j.events = append(j.events, event)
+	j.done = done
+	close(j.changed)
+	j.changed = make(chan struct{})
+	j.mu.Unlock()
+}
+
+// JobManager 管理进程内的批量验证任务
+type JobManager struct {
+	validator *CookieValidator
+	checker   cookieChecker   // 验证单个 Cookie，即 validator
+	ctx       context.Context // Stop 时取消，正在进行的验证随之中断
+	cancel    context.CancelFunc
+	running   sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*ValidationJob
+}
+
+// NewJobManager 创建任务管理器
+func NewJobManager(validator *CookieValidator) *JobManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobManager{
+		validator: validator,
+		checker:   validator,
+		ctx:       ctx,
+		cancel:    cancel,
+		jobs:      make(map[string]*ValidationJob),
+	}
+}
+
+// Stop 取消所有正在进行的任务并等待其结束
+func (m *JobManager) Stop() {
+	m.cancel()
+	m.running.Wait()
+}
+
+// StartValidateAll 在后台并行验证用户的所有 Cookie，返回任务
+func (m *JobManager) StartValidateAll(userID uint) (*ValidationJob, error) {
+	cookies, err := m.validator.service.ListCookies(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &ValidationJob{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Total:     len(cookies),
+		CreatedAt: time.Now(),
+		changed:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		m.run(m.ctx, job, cookies)
+	}()
+	return job, nil
+}
+
+// GetJob 获取用户的任务
+func (m *JobManager) GetJob(id string, userID uint) (*ValidationJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.UserID != userID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// run 以有限并发验证 Cookie，每完成一个发布一个事件；ctx 取消后不再开始新的验证
+func (m *JobManager) run(ctx context.Context, job *ValidationJob, cookies []model.MorphCookie) {
+	var (
+		mu         sync.Mutex
+		completed  int
+		validCount int
+		wg         sync.WaitGroup
+	)
+	sem := make(chan struct{}, m.validator.concurrency)
+
+	for i := range cookies {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(cookie *model.MorphCookie) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := m.checker.Validate(ctx, cookie, model.ValidationSourceManual)
+			if ctx.Err() != nil {
+				return
+			}
+
+			// 在锁内发布，保证事件中的计数递增
+			mu.Lock()
+			defer mu.Unlock()
+			completed++
+			if result.IsValid {
+				validCount++
+			}
+			job.publish(JobEvent{
+				Type:       JobEventResult,
+				CookieID:   cookie.ID,
+				Name:       cookie.Name,
+				IsValid:    result.IsValid,
+				Transient:  result.Transient,
+				StatusCode: result.StatusCode,
+				LatencyMs:  result.Latency.Milliseconds(),
+				Error:      truncateString(result.Error, maxErrorLength),
+				Completed:  completed,
+				Total:      job.Total,
+				ValidCount: validCount,
+			}, false)
+		}(&cookies[i])
+	}
+	wg.Wait()
+
+	job.publish(JobEvent{
+		Type:       JobEventDone,
+		Completed:  completed,
+		Total:      job.Total,
+		ValidCount: validCount,
+		Cancelled:  ctx.Err() != nil,
+	}, true)
+	if ctx.Err() != nil {
+		log.Printf("[INFO] Validation job %s cancelled after %d/%d cookie(s)", job.ID, completed, job.Total)
+	} else {
+		log.Printf("[INFO] Validation job %s finished: %d/%d valid", job.ID, validCount, job.Total)
+	}
+
+	time.AfterFunc(jobRetention, func() {
+		m.mu.Lock()
+		delete(m.jobs, job.ID)
+		m.mu.Unlock()
+	})
+}
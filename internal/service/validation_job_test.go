@@ -0,0 +1,64 @@
+package service
+
+import "testing"
+
+func TestValidationJobEvents(t *testing.T) {
+	job := &ValidationJob{Total: 2, changed: make(chan struct{})}
+
+	events, done, changed := job.Events(0)
+	if len(events) != 0 || done {
+		t.Fatalf("new job: events=%v done=%v", events, done)
+	}
+
+	job.publish(JobEvent{Type: JobEventResult, CookieID: 1, Completed: 1, Total: 2}, false)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("subscriber not notified")
+	}
+
+	job.publish(JobEvent{Type: JobEventResult, CookieID: 2, Completed: 2, Total: 2}, false)
+	job.publish(JobEvent{Type: JobEventDone, Completed: 2, Total: 2}, true)
+
+	// A late subscriber replays everything from its cursor
+	events, done, _ = job.Events(1)
+	if len(events) != 2 || !done {
+		t.Fatalf("Events(1) = %d events, done=%v", len(events), done)
+	}
+	if events[0].CookieID != 2 || events[1].Type != JobEventDone {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	if events, _, _ := job.Events(10); len(events) != 0 {
+		t.Errorf("cursor past end returned %d events", len(events))
+	}
+}
+
+func TestJobManagerStopCancelsRunningJobs(t *testing.T) {
+	m := NewJobManager(&CookieValidator{concurrency: 2})
+	checker := &stubChecker{block: make(chan struct{}), started: make(chan uint, 10)}
+	m.checker = checker
+	job := &ValidationJob{Total: 3, changed: make(chan struct{})}
+
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		m.run(m.ctx, job, uncheckedCookies(3))
+	}()
+	<-checker.started
+	<-checker.started
+
+	// Stop 中断正在进行的验证，不再开始新的验证
+	m.Stop()
+
+	events, done, _ := job.Events(0)
+	if !done || len(events) != 1 {
+		t.Fatalf("expected only the done event, got %+v (done=%v)", events, done)
+	}
+	if events[0].Type != JobEventDone || !events[0].Cancelled {
+		t.Errorf("expected a cancelled done event, got %+v", events[0])
+	}
+	if checker.cancelled != 2 || len(checker.checked) != 2 {
+		t.Errorf("expected the 2 running validations to be cancelled, got %d of %d", checker.cancelled, len(checker.checked))
+	}
+}
@@ -2,12 +2,16 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"opus-api/internal/converter"
 	"opus-api/internal/model"
 	"opus-api/internal/types"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,26 +19,56 @@ import (
 
 // CookieValidator Cookie 验证器
 type CookieValidator struct {
-	service *CookieService
+	service     *CookieService
+	concurrency int // 批量验证时的并发数
 }
 
 // NewCookieValidator 创建验证器
 func NewCookieValidator(service *CookieService) *CookieValidator {
-	return &CookieValidator{service: service}
+	return &CookieValidator{
+		service:     service,
+		concurrency: positiveIntFromEnv("VALIDATION_CONCURRENCY", DefaultValidationConcurrency),
+	}
+}
+
+// maxValidationErrorLength 验证历史中保存的错误信息的最大长度
+const maxValidationErrorLength = 500
+
+// ValidationResult 一次 Cookie 测试的结果
+type ValidationResult struct {
+	IsValid    bool
+	Transient  bool // 429、5xx 或网络错误，无法判断 Cookie 是否有效
+	StatusCode int  // 0 表示没有收到响应
+	Latency    time.Duration
+	Error      string
 }
 
-// ValidateCookie 验证单个 Cookie
+// ValidateCookie 验证单个 Cookie（手动验证）
 func (v *CookieValidator) ValidateCookie(cookie *model.MorphCookie) bool {
-	result := v.testCookie(cookie)
+	return v.Validate(context.Background(), cookie, model.ValidationSourceManual).IsValid
+}
+
+// Validate 测试 Cookie，更新其状态并记录验证历史。
+// 暂时性的失败不改变 Cookie 的有效状态，返回的 IsValid 为 Cookie 当前状态
+func (v *CookieValidator) Validate(ctx context.Context, cookie *model.MorphCookie, source string) ValidationResult {
+	result := v.testCookie(ctx, cookie)
 
 	db := v.service.GetDB()
-	if result {
+	switch {
+	case result.Transient:
+		result.IsValid = cookie.IsValid
+		db.Model(cookie).Updates(map[string]interface{}{
+			"last_validated": time.Now(),
+		})
+	case result.IsValid:
 		db.Model(cookie).Updates(map[string]interface{}{
 			"is_valid":       true,
 			"last_validated": time.Now(),
 			"error_count":    0,
+			"cooldown_until": nil,
+			"cooldown_count": 0,
 		})
-	} else {
+	default:
 		db.Model(cookie).Updates(map[string]interface{}{
 			"is_valid":       false,
 			"last_validated": time.Now(),
@@ -42,26 +76,40 @@ func (v *CookieValidator) ValidateCookie(cookie *model.MorphCookie) bool {
 		})
 	}
 
+	if ctx.Err() == nil {
+		v.recordValidation(cookie.ID, source, result)
+	}
+
 	return result
 }
 
-// ValidateAllCookies 验证用户的所有 Cookie
-func (v *CookieValidator) ValidateAllCookies(userID uint) map[uint]bool {
-	cookies, err := v.service.ListCookies(userID)
-	if err != nil {
-		return nil
+// recordValidation 保存验证历史
+func (v *CookieValidator) recordValidation(cookieID uint, source string, result ValidationResult) {
+	validation := &model.CookieValidation{
+		CookieID:   cookieID,
+		Source:     source,
+		IsValid:    result.IsValid,
+		StatusCode: result.StatusCode,
+		LatencyMs:  result.Latency.Milliseconds(),
+		Error:      truncateString(result.Error, maxValidationErrorLength),
 	}
-
-	results := make(map[uint]bool)
-	for _, cookie := range cookies {
-		results[cookie.ID] = v.ValidateCookie(&cookie)
+	if err := v.service.GetDB().Create(validation).Error; err != nil {
+		log.Printf("[WARN] Failed to record validation for cookie (ID: %d): %v", cookieID, err)
 	}
+}
 
-	return results
+// ListValidations 获取 Cookie 最近的验证历史
+func (v *CookieValidator) ListValidations(cookieID uint, limit int) ([]model.CookieValidation, error) {
+	var validations []model.CookieValidation
+	err := v.service.GetDB().Where("cookie_id = ?", cookieID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&validations).Error
+	return validations, err
 }
 
 // testCookie 测试 Cookie 是否有效（与 /v1/messages 逻辑完全一致）
-func (v *CookieValidator) testCookie(cookie *model.MorphCookie) bool {
+func (v *CookieValidator) testCookie(ctx context.Context, cookie *model.MorphCookie) ValidationResult {
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 	}
@@ -82,9 +130,9 @@ func (v *CookieValidator) testCookie(cookie *model.MorphCookie) bool {
 	morphReq := converter.ClaudeToMorph(claudeReq)
 
 	reqBody, _ := json.Marshal(morphReq)
-	req, err := http.NewRequest("POST", types.MorphAPIURL, bytes.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", types.MorphAPIURL, bytes.NewReader(reqBody))
 	if err != nil {
-		return false
+		return ValidationResult{Error: err.Error()}
 	}
 
 	// 使用与 /v1/messages 相同的请求头
@@ -94,16 +142,28 @@ func (v *CookieValidator) testCookie(cookie *model.MorphCookie) bool {
 	// 覆盖 Cookie
 	req.Header.Set("cookie", cookie.APIKey)
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return false
+		return ValidationResult{Transient: true, Latency: time.Since(start), Error: err.Error()}
 	}
 	defer resp.Body.Close()
+	latency := time.Since(start)
+
+	result := ValidationResult{StatusCode: resp.StatusCode, Latency: latency}
 
 	// 检查响应状态码
-	// 200 OK 表示成功，401/403 表示认证失败
+	// 200 OK 表示成功，401/403 表示认证失败，429/5xx 为暂时性错误
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return false
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxValidationErrorLength))
+		result.Error = fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		return result
+	}
+	if isTransientStatus(resp.StatusCode) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxValidationErrorLength))
+		result.Transient = true
+		result.Error = fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		return result
 	}
 
 	// 尝试读取响应体
@@ -111,13 +171,15 @@ func (v *CookieValidator) testCookie(cookie *model.MorphCookie) bool {
 
 	// 检查是否是有效的 API 响应（SSE 流格式）
 	bodyStr := string(body)
-	
+
 	// Morph API 返回 SSE 流，有效的响应会包含 "data:" 前缀
 	if !containsPrefix(bodyStr, "data:") {
-		return false
+		result.Error = fmt.Sprintf("unexpected response (%s): %s", resp.Status, strings.TrimSpace(bodyStr))
+		return result
 	}
 
-	return true
+	result.IsValid = true
+	return result
 }
 
 // containsPrefix 检查字符串是否包含指定前缀（忽略空白字符）
@@ -137,5 +199,5 @@ func containsPrefix(s, prefix string) bool {
 
 // validateCookieQuiet 静默验证 Cookie（不更新数据库）
 func (v *CookieValidator) validateCookieQuiet(cookie *model.MorphCookie) bool {
-	return v.testCookie(cookie)
+	return v.testCookie(context.Background(), cookie).IsValid
 }
\ No newline at end of file
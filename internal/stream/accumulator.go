@@ -0,0 +1,187 @@
+package stream
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Message is a complete Claude message assembled from a stream,
+// as returned by /v1/messages when stream is false
+type Message struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Content      []interface{}  `json:"content"`
+	Model        string         `json:"model"`
+	StopReason   interface{}    `json:"stop_reason"`
+	StopSequence interface{}    `json:"stop_sequence"`
+	Usage        map[string]int `json:"usage"`
+}
+
+// accumulatedBlock tracks a content block while its deltas arrive
+type accumulatedBlock struct {
+	blockType   string
+	text        strings.Builder
+	toolID      string
+	toolName    string
+	toolInput   map[string]interface{}
+	partialJSON strings.Builder
+}
+
+// MessageAccumulator collects the Claude SSE events written by
+// TransformMorphToClaudeStream and assembles them into a single Message
+type MessageAccumulator struct {
+	*EventWriter
+	message Message
+	blocks  map[int]*accumulatedBlock
+	order   []int
+}
+
+// NewMessageAccumulator creates an accumulator. The model and input token
+// count are used as defaults in case the stream never sends message_start.
+func NewMessageAccumulator(model string, inputTokens int) *MessageAccumulator {
+	acc := &MessageAccumulator{
+		message: Message{
+			ID:    "msg_" + generateUUID(),
+			Type:  "message",
+			Role:  "assistant",
+			Model: model,
+			Usage: map[string]int{"input_tokens": inputTokens, "output_tokens": 0},
+		},
+		blocks: make(map[int]*accumulatedBlock),
+	}
+	acc.EventWriter = NewEventWriter(acc.handleEvent)
+	return acc
+}
+
+func (a *MessageAccumulator) handleEvent(event string, data []byte) {
+	switch event {
+	case "message_start":
+		var ev struct {
+			Message struct {
+				ID    string         `json:"id"`
+				Model string         `json:"model"`
+				Usage map[string]int `json:"usage"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return
+		}
+		if ev.Message.ID != "" {
+			a.message.ID = ev.Message.ID
+		}
+		if ev.Message.Model != "" {
+			a.message.Model = ev.Message.Model
+		}
+		if tokens, ok := ev.Message.Usage["input_tokens"]; ok {
+			a.message.Usage["input_tokens"] = tokens
+		}
+
+	case "content_block_start":
+		var ev struct {
+			Index        int `json:"index"`
+			ContentBlock struct {
+				Type  string                 `json:"type"`
+				Text  string                 `json:"text"`
+				ID    string                 `json:"id"`
+				Name  string                 `json:"name"`
+				Input map[string]interface{} `json:"input"`
+			} `json:"content_block"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return
+		}
+		block := &accumulatedBlock{
+			blockType: ev.ContentBlock.Type,
+			toolID:    ev.ContentBlock.ID,
+			toolName:  ev.ContentBlock.Name,
+			toolInput: ev.ContentBlock.Input,
+		}
+		block.text.WriteString(ev.ContentBlock.Text)
+		if _, exists := a.blocks[ev.Index]; !exists {
+			a.order = append(a.order, ev.Index)
+		}
+		a.blocks[ev.Index] = block
+
+	case "content_block_delta":
+		var ev struct {
+			Index int `json:"index"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return
+		}
+		block, ok := a.blocks[ev.Index]
+		if !ok {
+			return
+		}
+		switch ev.Delta.Type {
+		case "text_delta":
+			block.text.WriteString(ev.Delta.Text)
+		case "input_json_delta":
+			block.partialJSON.WriteString(ev.Delta.PartialJSON)
+		}
+
+	case "message_delta":
+		var ev struct {
+			Delta struct {
+				StopReason   interface{} `json:"stop_reason"`
+				StopSequence interface{} `json:"stop_sequence"`
+			} `json:"delta"`
+			Usage map[string]int `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return
+		}
+		if ev.Delta.StopReason != nil {
+			a.message.StopReason = ev.Delta.StopReason
+		}
+		a.message.StopSequence = ev.Delta.StopSequence
+		if tokens, ok := ev.Usage["output_tokens"]; ok {
+			a.message.Usage["output_tokens"] = tokens
+		}
+	}
+}
+
+// Message returns the assembled message
+func (a *MessageAccumulator) Message() Message {
+	msg := a.message
+	msg.Content = []interface{}{}
+
+	for _, index := range a.order {
+		block := a.blocks[index]
+		switch block.blockType {
+		case "text":
+			if block.text.Len() == 0 {
+				continue
+			}
+			msg.Content = append(msg.Content, TextContentBlock{Type: "text", Text: block.text.String()})
+		case "tool_use":
+			input := block.toolInput
+			if block.partialJSON.Len() > 0 {
+				var parsed map[string]interface{}
+				if err := json.Unmarshal([]byte(block.partialJSON.String()), &parsed); err == nil {
+					input = parsed
+				}
+			}
+			if input == nil {
+				input = map[string]interface{}{}
+			}
+			msg.Content = append(msg.Content, ToolUseContentBlock{
+				Type:  "tool_use",
+				ID:    block.toolID,
+				Name:  block.toolName,
+				Input: input,
+			})
+		}
+	}
+
+	if msg.StopReason == nil {
+		msg.StopReason = "end_turn"
+	}
+	return msg
+}
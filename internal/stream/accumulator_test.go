@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMessageAccumulator_Text tests assembling a plain text response
+func TestMessageAccumulator_Text(t *testing.T) {
+	testData := `data: {"type":"start"}
+
+data: {"type":"text-start","id":"0"}
+
+data: {"type":"text-delta","id":"0","delta":"Hello"}
+
+data: {"type":"text-delta","id":"0","delta":" world"}
+
+data: {"type":"text-end","id":"0"}
+
+data: {"type":"finish","finishReason":"stop"}
+
+data: [DONE]
+
+`
+
+	accumulator := NewMessageAccumulator("claude-opus-4-5-20251101", 12)
+	if err := TransformMorphToClaudeStream(strings.NewReader(testData), "claude-opus-4-5-20251101", 12, TransformOptions{}, accumulator, nil); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	message := accumulator.Message()
+
+	if message.Type != "message" || message.Role != "assistant" {
+		t.Errorf("Unexpected message envelope: type=%s role=%s", message.Type, message.Role)
+	}
+	if message.StopReason != "end_turn" {
+		t.Errorf("Expected stop_reason end_turn, got %v", message.StopReason)
+	}
+	if message.Usage["input_tokens"] != 12 {
+		t.Errorf("Expected 12 input tokens, got %d", message.Usage["input_tokens"])
+	}
+	if len(message.Content) != 1 {
+		t.Fatalf("Expected 1 content block, got %d", len(message.Content))
+	}
+
+	textBlock, ok := message.Content[0].(TextContentBlock)
+	if !ok {
+		t.Fatalf("Expected text block, got %T", message.Content[0])
+	}
+	if textBlock.Text != "Hello world" {
+		t.Errorf("Expected 'Hello world', got '%s'", textBlock.Text)
+	}
+}
+
+// TestMessageAccumulator_ToolUse tests assembling a response with a tool call
+func TestMessageAccumulator_ToolUse(t *testing.T) {
+	testData := `data: {"type":"start"}
+
+data: {"type":"text-start","id":"0"}
+
+data: {"type":"text-delta","id":"0","delta":"Let me read it.\n<function_calls>\n<invoke name=\"Read\">\n"}
+
+data: {"type":"text-delta","id":"0","delta":"<parameter name=\"file_path\">/tmp/a.go</parameter>\n</invoke>\n</function_calls>"}
+
+data: {"type":"text-end","id":"0"}
+
+data: {"type":"finish-step"}
+
+data: {"type":"finish","finishReason":"stop"}
+
+data: [DONE]
+
+`
+
+	accumulator := NewMessageAccumulator("claude-opus-4-5-20251101", 0)
+	if err := TransformMorphToClaudeStream(strings.NewReader(testData), "claude-opus-4-5-20251101", 0, TransformOptions{}, accumulator, nil); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	message := accumulator.Message()
+
+	if message.StopReason != "tool_use" {
+		t.Errorf("Expected stop_reason tool_use, got %v", message.StopReason)
+	}
+	if message.Usage["output_tokens"] == 0 {
+		t.Error("Expected output tokens to be counted")
+	}
+
+	var toolUse *ToolUseContentBlock
+	for _, block := range message.Content {
+		if b, ok := block.(ToolUseContentBlock); ok {
+			toolUse = &b
+		}
+	}
+	if toolUse == nil {
+		t.Fatalf("Missing tool_use block in %+v", message.Content)
+	}
+	if toolUse.Name != "Read" {
+		t.Errorf("Expected tool name 'Read', got '%s'", toolUse.Name)
+	}
+	if toolUse.Input["file_path"] != "/tmp/a.go" {
+		t.Errorf("Expected file_path '/tmp/a.go', got %v", toolUse.Input["file_path"])
+	}
+	if !strings.HasPrefix(toolUse.ID, "toolu_") {
+		t.Errorf("Unexpected tool_use id '%s'", toolUse.ID)
+	}
+}
@@ -0,0 +1,268 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"opus-api/internal/types"
+	"time"
+)
+
+// OpenAIStreamWriter consumes the Claude SSE events written by
+// TransformMorphToClaudeStream and re-emits them as OpenAI
+// chat.completion.chunk frames on the underlying writer
+type OpenAIStreamWriter struct {
+	*EventWriter
+	writer       io.Writer
+	onChunk      func(string)
+	id           string
+	model        string
+	created      int64
+	includeUsage bool
+
+	roleSent      bool
+	finished      bool
+	inputTokens   int
+	toolCallIndex map[int]int // Claude content block index -> tool_calls index
+	toolArgsSent  map[int]bool
+	toolInputs    map[int]map[string]interface{}
+}
+
+// NewOpenAIStreamWriter creates a writer that emits OpenAI chunks to w.
+// onChunk, if set, receives every frame written (used for logging).
+func NewOpenAIStreamWriter(w io.Writer, model string, includeUsage bool, onChunk func(string)) *OpenAIStreamWriter {
+	sw := &OpenAIStreamWriter{
+		writer:        w,
+		onChunk:       onChunk,
+		id:            "chatcmpl-" + generateShortUUID(),
+		model:         model,
+		created:       time.Now().Unix(),
+		includeUsage:  includeUsage,
+		toolCallIndex: make(map[int]int),
+		toolArgsSent:  make(map[int]bool),
+		toolInputs:    make(map[int]map[string]interface{}),
+	}
+	sw.EventWriter = NewEventWriter(sw.handleEvent)
+	return sw
+}
+
+func (w *OpenAIStreamWriter) handleEvent(event string, data []byte) {
+	switch event {
+	case "message_start":
+		var ev struct {
+			Message struct {
+				Usage map[string]int `json:"usage"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(data, &ev); err == nil {
+			w.inputTokens = ev.Message.Usage["input_tokens"]
+		}
+		w.ensureRole()
+
+	case "content_block_start":
+		var ev struct {
+			Index        int `json:"index"`
+			ContentBlock struct {
+				Type  string                 `json:"type"`
+				ID    string                 `json:"id"`
+				Name  string                 `json:"name"`
+				Input map[string]interface{} `json:"input"`
+			} `json:"content_block"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil || ev.ContentBlock.Type != "tool_use" {
+			return
+		}
+		w.ensureRole()
+		toolIndex := len(w.toolCallIndex)
+		w.toolCallIndex[ev.Index] = toolIndex
+		w.toolInputs[ev.Index] = ev.ContentBlock.Input
+		w.emitDelta(types.OpenAIChunkDelta{
+			ToolCalls: []types.OpenAIToolCall{{
+				Index:    &toolIndex,
+				ID:       ev.ContentBlock.ID,
+				Type:     "function",
+				Function: types.OpenAIFunctionCall{Name: ev.ContentBlock.Name, Arguments: ""},
+			}},
+		}, nil)
+
+	case "content_block_delta":
+		var ev struct {
+			Index int `json:"index"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return
+		}
+		w.ensureRole()
+		switch ev.Delta.Type {
+		case "text_delta":
+			if ev.Delta.Text == "" {
+				return
+			}
+			text := ev.Delta.Text
+			w.emitDelta(types.OpenAIChunkDelta{Content: &text}, nil)
+		case "input_json_delta":
+			toolIndex, ok := w.toolCallIndex[ev.Index]
+			if !ok || ev.Delta.PartialJSON == "" {
+				return
+			}
+			w.toolArgsSent[ev.Index] = true
+			w.emitDelta(types.OpenAIChunkDelta{
+				ToolCalls: []types.OpenAIToolCall{{
+					Index:    &toolIndex,
+					Function: types.OpenAIFunctionCall{Arguments: ev.Delta.PartialJSON},
+				}},
+			}, nil)
+		}
+
+	case "content_block_stop":
+		var ev struct {
+			Index int `json:"index"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return
+		}
+		// Tool input carried only by content_block_start
+		toolIndex, ok := w.toolCallIndex[ev.Index]
+		if !ok || w.toolArgsSent[ev.Index] {
+			return
+		}
+		w.toolArgsSent[ev.Index] = true
+		w.emitDelta(types.OpenAIChunkDelta{
+			ToolCalls: []types.OpenAIToolCall{{
+				Index:    &toolIndex,
+				Function: types.OpenAIFunctionCall{Arguments: mustMarshalJSON(w.toolInputs[ev.Index])},
+			}},
+		}, nil)
+
+	case "message_delta":
+		var ev struct {
+			Delta struct {
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage map[string]int `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil || w.finished {
+			return
+		}
+		w.ensureRole()
+		w.finished = true
+		finishReason := OpenAIFinishReason(ev.Delta.StopReason)
+		w.emitDelta(types.OpenAIChunkDelta{}, &finishReason)
+		if w.includeUsage {
+			outputTokens := ev.Usage["output_tokens"]
+			w.emit(types.OpenAIChatCompletionChunk{
+				ID:      w.id,
+				Object:  "chat.completion.chunk",
+				Created: w.created,
+				Model:   w.model,
+				Choices: []types.OpenAIChunkChoice{},
+				Usage: &types.OpenAIUsage{
+					PromptTokens:     w.inputTokens,
+					CompletionTokens: outputTokens,
+					TotalTokens:      w.inputTokens + outputTokens,
+				},
+			})
+		}
+
+	case "message_stop":
+		w.write("data: [DONE]\n\n")
+	}
+}
+
+// ensureRole emits the initial assistant role chunk once
+func (w *OpenAIStreamWriter) ensureRole() {
+	if w.roleSent {
+		return
+	}
+	w.roleSent = true
+	empty := ""
+	w.emitDelta(types.OpenAIChunkDelta{Role: "assistant", Content: &empty}, nil)
+}
+
+func (w *OpenAIStreamWriter) emitDelta(delta types.OpenAIChunkDelta, finishReason *string) {
+	w.emit(types.OpenAIChatCompletionChunk{
+		ID:      w.id,
+		Object:  "chat.completion.chunk",
+		Created: w.created,
+		Model:   w.model,
+		Choices: []types.OpenAIChunkChoice{{
+			Index:        0,
+			Delta:        delta,
+			FinishReason: finishReason,
+		}},
+	})
+}
+
+func (w *OpenAIStreamWriter) emit(chunk types.OpenAIChatCompletionChunk) {
+	w.write(fmt.Sprintf("data: %s\n\n", mustMarshalJSON(chunk)))
+}
+
+func (w *OpenAIStreamWriter) write(frame string) {
+	if w.onChunk != nil {
+		w.onChunk(frame)
+	}
+	w.writer.Write([]byte(frame))
+}
+
+// OpenAIFinishReason maps a Claude stop_reason to an OpenAI finish_reason
+func OpenAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+// MessageToChatCompletion converts an assembled Claude message to an
+// OpenAI chat.completion object
+func MessageToChatCompletion(msg Message, model string) types.OpenAIChatCompletion {
+	reply := types.OpenAIMessage{Role: "assistant"}
+	var text string
+	for _, block := range msg.Content {
+		switch b := block.(type) {
+		case TextContentBlock:
+			text += b.Text
+		case ToolUseContentBlock:
+			reply.ToolCalls = append(reply.ToolCalls, types.OpenAIToolCall{
+				ID:   b.ID,
+				Type: "function",
+				Function: types.OpenAIFunctionCall{
+					Name:      b.Name,
+					Arguments: mustMarshalJSON(b.Input),
+				},
+			})
+		}
+	}
+	if text != "" || len(reply.ToolCalls) == 0 {
+		reply.Content = text
+	}
+
+	stopReason, _ := msg.StopReason.(string)
+	inputTokens := msg.Usage["input_tokens"]
+	outputTokens := msg.Usage["output_tokens"]
+
+	return types.OpenAIChatCompletion{
+		ID:      "chatcmpl-" + generateShortUUID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []types.OpenAIChoice{{
+			Index:        0,
+			Message:      reply,
+			FinishReason: OpenAIFinishReason(stopReason),
+		}},
+		Usage: &types.OpenAIUsage{
+			PromptTokens:     inputTokens,
+			CompletionTokens: outputTokens,
+			TotalTokens:      inputTokens + outputTokens,
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestOpenAIStreamWriter_ToolCall tests that tool calls are re-emitted as
+// OpenAI tool_calls deltas with incremental arguments
+func TestOpenAIStreamWriter_ToolCall(t *testing.T) {
+	testData := `data: {"type":"start"}
+
+data: {"type":"text-start","id":"0"}
+
+data: {"type":"text-delta","id":"0","delta":"Checking.\n<function_calls>\n<invoke name=\"Bash\">\n<parameter name=\"command\">ls -la</parameter>\n</invoke>\n</function_calls>"}
+
+data: {"type":"text-end","id":"0"}
+
+data: {"type":"finish","finishReason":"stop"}
+
+data: [DONE]
+
+`
+
+	var output bytes.Buffer
+	writer := NewOpenAIStreamWriter(&output, "claude-opus-4-5-20251101", true, nil)
+	if err := TransformMorphToClaudeStream(strings.NewReader(testData), "claude-opus-4-5-20251101", 7, TransformOptions{}, writer, nil); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	outputStr := output.String()
+	if strings.Contains(outputStr, "event:") {
+		t.Error("OpenAI stream should not contain Claude event lines")
+	}
+	if !strings.HasSuffix(outputStr, "data: [DONE]\n\n") {
+		t.Error("Stream should end with data: [DONE]")
+	}
+
+	var arguments, toolName, finishReason string
+	var content strings.Builder
+	var usageSeen bool
+	for _, frame := range strings.Split(outputStr, "\n\n") {
+		data := strings.TrimPrefix(frame, "data: ")
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Delta struct {
+					Content   *string `json:"content"`
+					ToolCalls []struct {
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens int `json:"prompt_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Invalid chunk %q: %v", data, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("Unexpected object '%s'", chunk.Object)
+		}
+		if chunk.Usage != nil {
+			usageSeen = true
+			if chunk.Usage.PromptTokens != 7 {
+				t.Errorf("Expected 7 prompt tokens, got %d", chunk.Usage.PromptTokens)
+			}
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != nil {
+				content.WriteString(*choice.Delta.Content)
+			}
+			for _, toolCall := range choice.Delta.ToolCalls {
+				if toolCall.Function.Name != "" {
+					toolName = toolCall.Function.Name
+				}
+				arguments += toolCall.Function.Arguments
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+
+	if toolName != "Bash" {
+		t.Errorf("Expected tool 'Bash', got '%s'", toolName)
+	}
+	if arguments != `{"command":"ls -la"}` {
+		t.Errorf("Unexpected arguments '%s'", arguments)
+	}
+	if finishReason != "tool_calls" {
+		t.Errorf("Expected finish_reason tool_calls, got '%s'", finishReason)
+	}
+	if !strings.Contains(content.String(), "Checking.") {
+		t.Errorf("Missing text content, got '%s'", content.String())
+	}
+	if !usageSeen {
+		t.Error("Missing usage chunk with include_usage")
+	}
+}
@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -76,4 +77,47 @@ type MessageDeltaEvent struct {
 
 type MessageStopEvent struct {
 	Type string `json:"type"`
-}
\ No newline at end of file
+}
+
+// EventWriter is an io.Writer that splits written SSE frames into events
+// and hands each one to a callback. It lets callers consume the stream
+// produced by TransformMorphToClaudeStream without an HTTP round trip.
+type EventWriter struct {
+	pending []byte
+	onEvent func(event string, data []byte)
+}
+
+// NewEventWriter creates an EventWriter that calls onEvent for every frame
+func NewEventWriter(onEvent func(event string, data []byte)) *EventWriter {
+	return &EventWriter{onEvent: onEvent}
+}
+
+// Write buffers p and dispatches every complete frame
+func (w *EventWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.Index(w.pending, []byte("\n\n"))
+		if end == -1 {
+			break
+		}
+		frame := w.pending[:end]
+		w.pending = w.pending[end+2:]
+		w.dispatch(frame)
+	}
+	return len(p), nil
+}
+
+func (w *EventWriter) dispatch(frame []byte) {
+	var event string
+	var data []byte
+	for _, line := range bytes.Split(frame, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("event: ")) {
+			event = string(bytes.TrimPrefix(line, []byte("event: ")))
+		} else if bytes.HasPrefix(line, []byte("data: ")) {
+			data = append(data, bytes.TrimPrefix(line, []byte("data: "))...)
+		}
+	}
+	if event != "" && w.onEvent != nil {
+		w.onEvent(event, data)
+	}
+}
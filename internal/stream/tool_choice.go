@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ToolCallGate holds back the Claude SSE events written by
+// TransformMorphToClaudeStream until the message starts a tool_use block
+// for the required tool. From then on the held events and everything after
+// them are written to the underlying writer. If the message ends without
+// such a block nothing has been written, so the caller can discard it and
+// retry, or Release it as it is.
+type ToolCallGate struct {
+	w      io.Writer
+	tool   string // required tool, any tool when empty
+	events *EventWriter
+	held   bytes.Buffer
+	text   strings.Builder
+	open   bool
+}
+
+// NewToolCallGate creates a ToolCallGate writing to w. An empty tool
+// accepts a call to any tool.
+func NewToolCallGate(w io.Writer, tool string) *ToolCallGate {
+	g := &ToolCallGate{w: w, tool: tool}
+	g.events = NewEventWriter(g.handleEvent)
+	return g
+}
+
+// Write holds p back until the required tool call starts, then passes it
+// through to the underlying writer
+func (g *ToolCallGate) Write(p []byte) (int, error) {
+	if g.open {
+		return g.w.Write(p)
+	}
+	g.held.Write(p)
+	g.events.Write(p)
+	if g.open {
+		return len(p), g.Release()
+	}
+	return len(p), nil
+}
+
+func (g *ToolCallGate) handleEvent(event string, data []byte) {
+	var ev struct {
+		ContentBlock struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"content_block"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return
+	}
+	switch {
+	case event == "content_block_start" && ev.ContentBlock.Type == "tool_use":
+		if g.tool == "" || ev.ContentBlock.Name == g.tool {
+			g.open = true
+		}
+	case event == "content_block_delta" && ev.Delta.Type == "text_delta":
+		g.text.WriteString(ev.Delta.Text)
+	}
+}
+
+// Open reports whether the required tool call was seen and the output is
+// being passed through
+func (g *ToolCallGate) Open() bool {
+	return g.open
+}
+
+// Text returns the text of the message held back so far
+func (g *ToolCallGate) Text() string {
+	return g.text.String()
+}
+
+// Release writes the held events to the underlying writer and passes
+// everything written afterwards through
+func (g *ToolCallGate) Release() error {
+	g.open = true
+	if g.held.Len() == 0 {
+		return nil
+	}
+	_, err := g.w.Write(g.held.Bytes())
+	g.held.Reset()
+	return err
+}
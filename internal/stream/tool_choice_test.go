@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"opus-api/internal/types"
+	"strings"
+	"testing"
+)
+
+// TestTransformMorphToClaudeStream_ToolChoice tests stripping tool calls for
+// tool_choice none and keeping only the first one when parallel tool use is
+// disabled
+func TestTransformMorphToClaudeStream_ToolChoice(t *testing.T) {
+	deltas := []string{
+		"Checking.\n<function_calls>\n<invoke name=\"Read\">\n<parameter name=\"file_path\">/a</parameter>\n</invoke>\n",
+		"<invoke name=\"Read\">\n<parameter name=\"file_path\">/b</parameter>\n</invoke>\n</function_calls>\nDone.",
+	}
+
+	cases := []struct {
+		choice     types.ToolChoice
+		toolUses   int
+		text       string
+		stopReason string
+	}{
+		{types.ToolChoice{Type: types.ToolChoiceAuto}, 2, "Checking.", "tool_use"},
+		{types.ToolChoice{Type: types.ToolChoiceNone}, 0, "Checking.\nDone.", "end_turn"},
+		{types.ToolChoice{Type: types.ToolChoiceAuto, DisableParallelToolUse: true}, 1, "Checking.", "tool_use"},
+	}
+
+	for _, c := range cases {
+		accumulator := NewMessageAccumulator("claude-opus-4-5-20251101", 0)
+		options := TransformOptions{ToolChoice: c.choice}
+		if err := TransformMorphToClaudeStream(strings.NewReader(morphTextStream(deltas)), "claude-opus-4-5-20251101", 0, options, accumulator, nil); err != nil {
+			t.Fatalf("%+v: transform failed: %v", c.choice, err)
+		}
+
+		message := accumulator.Message()
+		var toolUses []ToolUseContentBlock
+		var text strings.Builder
+		for _, block := range message.Content {
+			switch b := block.(type) {
+			case ToolUseContentBlock:
+				toolUses = append(toolUses, b)
+			case TextContentBlock:
+				text.WriteString(b.Text)
+			}
+		}
+
+		if len(toolUses) != c.toolUses {
+			t.Errorf("%+v: expected %d tool_use blocks, got %d", c.choice, c.toolUses, len(toolUses))
+		}
+		if len(toolUses) > 0 && toolUses[0].Input["file_path"] != "/a" {
+			t.Errorf("%+v: expected the first tool call, got %v", c.choice, toolUses[0].Input)
+		}
+		if text.String() != c.text {
+			t.Errorf("%+v: expected text %q, got %q", c.choice, c.text, text.String())
+		}
+		if message.StopReason != c.stopReason {
+			t.Errorf("%+v: expected stop_reason %s, got %v", c.choice, c.stopReason, message.StopReason)
+		}
+	}
+}
+
+// TestToolCallGate tests that output is held back until the required tool
+// call starts
+func TestToolCallGate(t *testing.T) {
+	toolCall := []string{"Let me look.\n<function_calls>\n<invoke name=\"Read\">\n<parameter name=\"file_path\">/a</parameter>\n</invoke>\n</function_calls>"}
+	textOnly := []string{"I would read the file."}
+
+	cases := []struct {
+		deltas []string
+		tool   string
+		open   bool
+	}{
+		{toolCall, "", true},
+		{toolCall, "Read", true},
+		{toolCall, "Bash", false},
+		{textOnly, "", false},
+	}
+
+	for _, c := range cases {
+		var out strings.Builder
+		gate := NewToolCallGate(&out, c.tool)
+		if err := TransformMorphToClaudeStream(strings.NewReader(morphTextStream(c.deltas)), "claude-opus-4-5-20251101", 0, TransformOptions{}, gate, nil); err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		if gate.Open() != c.open {
+			t.Errorf("%q: expected open %v", c.tool, c.open)
+		}
+		if c.open != strings.Contains(out.String(), "message_stop") {
+			t.Errorf("%q: expected output only when open, got %q", c.tool, out.String())
+		}
+		if !strings.HasPrefix(c.deltas[0], gate.Text()) || gate.Text() == "" {
+			t.Errorf("%q: unexpected held text %q", c.tool, gate.Text())
+		}
+
+		if !c.open {
+			gate.Release()
+			if !strings.Contains(out.String(), "message_stop") {
+				t.Errorf("%q: expected the held message after Release", c.tool)
+			}
+		}
+	}
+}
@@ -19,7 +19,7 @@ func TestNativeToolCallConversion(t *testing.T) {
 	input := bytes.NewReader(testData)
 	var output bytes.Buffer
 
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -98,7 +98,7 @@ func TestMultipleFunctionCallsBlocks(t *testing.T) {
 	input := bytes.NewReader(testData)
 	var output bytes.Buffer
 
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -150,7 +150,7 @@ func TestRealWarpGrepToolCall(t *testing.T) {
 	input := bytes.NewReader(testData)
 	var output bytes.Buffer
 
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -237,7 +237,7 @@ func TestLatestMorphResponse(t *testing.T) {
 	input := bytes.NewReader(testData)
 	var output bytes.Buffer
 
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -287,7 +287,7 @@ func TestToolCallsWithTextAfter(t *testing.T) {
 	input := bytes.NewReader(testData)
 	var output bytes.Buffer
 
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -348,7 +348,7 @@ func TestTransformFromAbsolutePath(t *testing.T) {
 	input := bytes.NewReader(testData)
 	var output bytes.Buffer
 
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -0,0 +1,209 @@
+package stream
+
+import (
+	"fmt"
+	"opus-api/internal/parser"
+	"opus-api/internal/types"
+	"strings"
+)
+
+// valueMode is how a parameter value is written as JSON
+type valueMode int
+
+const (
+	valueUndecided valueMode = iota // could still be a JSON number, boolean or null
+	valueString                     // streamed as a JSON string while it arrives
+	valueBuffered                   // typed or JSON-looking value, written once complete
+)
+
+// toolInputEncoder writes the tool input JSON from the parameter events of
+// parser.StreamParser while the model is still generating them. Values are
+// coerced against the tool's input_schema: string parameters are streamed as
+// JSON string chunks, other typed parameters are buffered until they end and
+// converted with parser.CoerceParamValue. Parameters without a schema are
+// streamed when they are plain text and buffered when they look like JSON,
+// so the concatenated output matches parser.ParseToolCalls.
+type toolInputEncoder struct {
+	out     strings.Builder // JSON not flushed yet
+	params  int             // parameters written so far
+	tool    string
+	schemas parser.ToolSchemas
+	input   map[string]interface{} // coerced values of the finished parameters
+	errors  []string               // parameters whose value does not match the schema
+
+	name     string
+	property map[string]interface{} // schema of the current parameter, nil if not declared
+	mode     valueMode
+	raw      strings.Builder // current value with leading whitespace removed
+	space    string          // trailing whitespace held back from a string value
+	started  bool            // value has non-whitespace content
+}
+
+// newToolInputEncoder creates an encoder for one tool_use block
+func newToolInputEncoder(tool string, schemas parser.ToolSchemas) *toolInputEncoder {
+	return &toolInputEncoder{
+		tool:    tool,
+		schemas: schemas,
+		input:   make(map[string]interface{}),
+	}
+}
+
+// Handle processes a parameter or tool end event of the tool call
+func (s *toolInputEncoder) Handle(event parser.Event) {
+	switch event.Type {
+	case parser.EventParamStart:
+		s.StartParam(event.Name)
+	case parser.EventParamChunk:
+		s.AppendValue(event.Text)
+	case parser.EventParamEnd:
+		s.EndParam()
+	case parser.EventToolEnd:
+		s.Close()
+	}
+}
+
+// StartParam writes the key of a new parameter
+func (s *toolInputEncoder) StartParam(name string) {
+	if s.params == 0 {
+		s.out.WriteString("{")
+	} else {
+		s.out.WriteString(",")
+	}
+	s.params++
+	s.out.WriteString(mustMarshalJSON(name))
+	s.out.WriteString(":")
+
+	s.name = name
+	s.property = s.schemas.Property(s.tool, name)
+	s.raw.Reset()
+	s.space = ""
+	s.started = false
+
+	_, hasEnum := s.property["enum"]
+	switch {
+	case parser.IsStringOnly(s.property):
+		s.mode = valueString
+		s.out.WriteString(`"`)
+	case len(parser.SchemaTypes(s.property)) > 0 || hasEnum:
+		s.mode = valueBuffered
+	default:
+		s.mode = valueUndecided
+	}
+}
+
+// AppendValue adds raw value text, leading whitespace is dropped
+func (s *toolInputEncoder) AppendValue(text string) {
+	if !s.started {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return
+		}
+		s.started = true
+		if s.mode == valueUndecided && (text[0] == '{' || text[0] == '[' || text[0] == '"') {
+			s.mode = valueBuffered
+		}
+	}
+	s.raw.WriteString(text)
+
+	switch s.mode {
+	case valueString:
+		s.writeString(text)
+	case valueUndecided:
+		if !mayBeJSONLiteral(s.raw.String()) {
+			// Not a JSON literal, stream it as a string from here on
+			s.mode = valueString
+			s.out.WriteString(`"`)
+			s.writeString(s.raw.String())
+		}
+	}
+}
+
+// writeString writes string value text, holding back trailing whitespace
+// until more content follows so the value ends up trimmed
+func (s *toolInputEncoder) writeString(text string) {
+	text = s.space + text
+	content := strings.TrimRight(text, " \t\r\n")
+	s.space = text[len(content):]
+	if content != "" {
+		s.out.WriteString(escapeJSONString(content))
+	}
+}
+
+// EndParam finishes the current parameter value
+func (s *toolInputEncoder) EndParam() {
+	value, err := parser.CoerceParamValue(s.property, s.raw.String())
+	if err != nil {
+		s.errors = append(s.errors, fmt.Sprintf("parameter '%s': %v", s.name, err))
+	}
+	if s.mode == valueString {
+		s.out.WriteString(`"`)
+	} else {
+		s.out.WriteString(mustMarshalJSON(value))
+	}
+	s.input[s.name] = value
+	s.raw.Reset()
+	s.space = ""
+}
+
+// Close writes the end of the input object
+func (s *toolInputEncoder) Close() {
+	if s.params == 0 {
+		s.out.WriteString("{}")
+	} else {
+		s.out.WriteString("}")
+	}
+}
+
+// Flush returns the JSON written since the last call
+func (s *toolInputEncoder) Flush() string {
+	partialJSON := s.out.String()
+	s.out.Reset()
+	return partialJSON
+}
+
+// Problems validates the finished tool call against the request's tools
+func (s *toolInputEncoder) Problems() []string {
+	return s.schemas.Problems(types.ParsedToolCall{Name: s.tool, Input: s.input}, s.errors)
+}
+
+// toolCallText rebuilds the XML of a tool call from its parser events, used
+// when an invalid tool call is returned as text
+func toolCallText(events []parser.Event) string {
+	var text strings.Builder
+	for _, event := range events {
+		switch event.Type {
+		case parser.EventToolStart:
+			fmt.Fprintf(&text, "<invoke name=\"%s\">\n", event.Name)
+		case parser.EventParamStart:
+			fmt.Fprintf(&text, "<parameter name=\"%s\">", event.Name)
+		case parser.EventParamChunk:
+			text.WriteString(event.Text)
+		case parser.EventParamEnd:
+			text.WriteString("</parameter>\n")
+		case parser.EventToolEnd:
+			text.WriteString("</invoke>")
+		}
+	}
+	return text.String()
+}
+
+// mayBeJSONLiteral reports whether the value could still turn out to be a
+// JSON number, true, false or null
+func mayBeJSONLiteral(value string) bool {
+	value = strings.TrimRight(value, " \t\r\n")
+	if strings.ContainsAny(value, " \t\r\n") {
+		return false
+	}
+	for _, literal := range []string{"true", "false", "null"} {
+		if strings.HasPrefix(literal, value) {
+			return true
+		}
+	}
+	return strings.Trim(value, "0123456789+-.eE") == ""
+}
+
+// escapeJSONString returns text escaped for use inside a JSON string
+func escapeJSONString(text string) string {
+	quoted := mustMarshalJSON(text)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,226 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"opus-api/internal/parser"
+	"opus-api/internal/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encodeToolInput feeds text to the tool call parser in the given chunk size
+// and returns the JSON written by the encoder for the first tool call
+func encodeToolInput(t *testing.T, text string, chunkSize int, finish bool, schemas parser.ToolSchemas) map[string]interface{} {
+	toolParser := parser.NewStreamParser()
+	var encoder *toolInputEncoder
+	var partialJSON strings.Builder
+	handle := func(events []parser.Event) {
+		for _, event := range events {
+			if event.Type == parser.EventToolStart {
+				encoder = newToolInputEncoder(event.Name, schemas)
+			} else if encoder != nil {
+				encoder.Handle(event)
+			}
+			if encoder != nil {
+				partialJSON.WriteString(encoder.Flush())
+			}
+		}
+	}
+	for i := 0; i < len(text); i += chunkSize {
+		handle(toolParser.Feed(text[i:min(i+chunkSize, len(text))]))
+	}
+	if finish {
+		handle(toolParser.Finish())
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(partialJSON.String()), &input); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", partialJSON.String(), err)
+	}
+	return input
+}
+
+// testToolSchemas declares typed parameters for the tool "T" used in the tests
+var testToolSchemas = parser.NewToolSchemas([]types.ClaudeTool{{
+	Name: "T",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"taskId":  map[string]interface{}{"type": "string"},
+			"timeout": map[string]interface{}{"type": "integer"},
+			"n":       map[string]interface{}{"type": "number"},
+			"done":    map[string]interface{}{"type": "boolean"},
+			"todos":   map[string]interface{}{"type": "array"},
+			"opts":    map[string]interface{}{"type": "object"},
+			"word":    map[string]interface{}{"type": "boolean"},
+			"empty":   map[string]interface{}{"type": "integer"},
+			"command": map[string]interface{}{"type": "string", "enum": []interface{}{"ls"}},
+		},
+		"required": []interface{}{"file_path"},
+	},
+}})
+
+// TestToolInputEncoder_MatchesParser feeds invoke blocks one byte at a time
+// and checks the streamed JSON equals the non-streaming parse result
+func TestToolInputEncoder_MatchesParser(t *testing.T) {
+	cases := []string{
+		`<parameter name="file_path">/tmp/a.go</parameter>`,
+		"\n<parameter name=\"command\">  echo \"a < b\" && ls\n</parameter>\n<parameter name=\"timeout\">120</parameter>\n",
+		`<parameter name="taskId">1</parameter><parameter name="done">true</parameter><parameter name="n">-1.5e3</parameter>`,
+		`<parameter name="todos">[{"content": "x", "status": "pending"}]</parameter><parameter name="opts">{"a": 1}</parameter>`,
+		`<parameter name="content">line 1
+line 2 <parameter name="inner">x</parameter> </parameter>`,
+		`<parameter name="empty"></parameter><parameter name="word">trueish</parameter><parameter name="bad">{not json</parameter>`,
+		`<parameter name="html"><![CDATA[<div></parameter>]]></parameter>`,
+		``,
+	}
+
+	for i, params := range cases {
+		t.Run(fmt.Sprintf("case%d", i), func(t *testing.T) {
+			text := `<function_calls><invoke name="T">` + params + `</invoke></function_calls>`
+			for _, schemas := range []parser.ToolSchemas{nil, testToolSchemas} {
+				expected := parser.ParseToolCalls(text, schemas).ToolCalls[0].Input
+				input := encodeToolInput(t, text, 1, false, schemas)
+				if !reflect.DeepEqual(input, expected) {
+					t.Errorf("Expected %v, got %v", expected, input)
+				}
+			}
+		})
+	}
+}
+
+// TestToolInputEncoder_Finish tests closing the input when the stream ends
+// before </invoke>
+func TestToolInputEncoder_Finish(t *testing.T) {
+	input := encodeToolInput(t, `<invoke name="Grep"><parameter name="path">/tmp</parameter><parameter name="pattern">foo`, 7, true, nil)
+	if input["path"] != "/tmp" || input["pattern"] != "foo" {
+		t.Errorf("Unexpected input %v", input)
+	}
+}
+
+// TestTransformMorphToClaudeStream_StreamsToolInput tests that the tool_use
+// block opens before </invoke> arrives and its input is sent in chunks
+func TestTransformMorphToClaudeStream_StreamsToolInput(t *testing.T) {
+	deltas := []string{
+		"Let me check.\n<function_calls>\n<invoke name=\"Bash\">\n",
+		"<parameter name=\"command\">ls ",
+		"-la /tmp</parameter>\n",
+		"<parameter name=\"timeout\">60</parameter>\n",
+		"</invoke>\n</function_calls>",
+	}
+
+	var events []string
+	accumulator := NewMessageAccumulator("claude-opus-4-5-20251101", 0)
+	writer := NewEventWriter(func(event string, data []byte) {
+		events = append(events, event+" "+string(data))
+	})
+	if err := TransformMorphToClaudeStream(strings.NewReader(morphTextStream(deltas)), "claude-opus-4-5-20251101", 0, TransformOptions{}, io.MultiWriter(accumulator, writer), nil); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	toolStart, inputDeltas, toolStop := -1, 0, -1
+	for i, event := range events {
+		switch {
+		case strings.HasPrefix(event, "content_block_start") && strings.Contains(event, `"tool_use"`):
+			toolStart = i
+		case strings.Contains(event, `"input_json_delta"`):
+			inputDeltas++
+		case strings.HasPrefix(event, "content_block_stop") && toolStart != -1 && toolStop == -1:
+			toolStop = i
+		}
+	}
+	if toolStart == -1 {
+		t.Fatal("Missing tool_use content_block_start")
+	}
+	if inputDeltas < 3 {
+		t.Errorf("Expected input to be streamed in several chunks, got %d", inputDeltas)
+	}
+	if toolStop < toolStart+inputDeltas {
+		t.Errorf("Expected tool block to stop after its deltas")
+	}
+
+	message := accumulator.Message()
+	if message.StopReason != "tool_use" {
+		t.Errorf("Expected stop_reason tool_use, got %v", message.StopReason)
+	}
+	if len(message.Content) != 2 {
+		t.Fatalf("Expected text and tool_use blocks, got %+v", message.Content)
+	}
+	if text, ok := message.Content[0].(TextContentBlock); !ok || text.Text != "Let me check." {
+		t.Errorf("Unexpected text block %+v", message.Content[0])
+	}
+	toolUse, ok := message.Content[1].(ToolUseContentBlock)
+	if !ok {
+		t.Fatalf("Expected tool_use block, got %T", message.Content[1])
+	}
+	expected := map[string]interface{}{"command": "ls -la /tmp", "timeout": float64(60)}
+	if toolUse.Name != "Bash" || !reflect.DeepEqual(toolUse.Input, expected) {
+		t.Errorf("Unexpected tool_use %s %v", toolUse.Name, toolUse.Input)
+	}
+}
+
+// TestTransformMorphToClaudeStream_ToolValidationPolicy tests how tool calls
+// that do not match the declared tools are handled under each policy
+func TestTransformMorphToClaudeStream_ToolValidationPolicy(t *testing.T) {
+	deltas := []string{
+		"<function_calls>\n<invoke name=\"T\">\n<parameter name=\"file_path\">/a</parameter>\n",
+		"<parameter name=\"timeout\">60</parameter>\n</invoke>\n",
+		"<invoke name=\"Unknown\">\n<parameter name=\"x\">1</parameter>\n</invoke>\n",
+		"<invoke name=\"T\">\n<parameter name=\"timeout\">soon</parameter>\n</invoke>\n</function_calls>",
+	}
+
+	cases := []struct {
+		policy   types.ToolValidationPolicy
+		toolUses int
+		text     string
+	}{
+		{types.ToolPolicyPass, 3, ""},
+		{types.ToolPolicyDrop, 1, ""},
+		{types.ToolPolicyText, 1, "<invoke name=\"Unknown\">\n<parameter name=\"x\">1</parameter>\n</invoke>"},
+	}
+
+	for _, c := range cases {
+		accumulator := NewMessageAccumulator("claude-opus-4-5-20251101", 0)
+		options := TransformOptions{Tools: testToolSchemas, Policy: c.policy}
+		if err := TransformMorphToClaudeStream(strings.NewReader(morphTextStream(deltas)), "claude-opus-4-5-20251101", 0, options, accumulator, nil); err != nil {
+			t.Fatalf("%s: transform failed: %v", c.policy, err)
+		}
+
+		var toolUses []ToolUseContentBlock
+		var text strings.Builder
+		for _, block := range accumulator.Message().Content {
+			switch b := block.(type) {
+			case ToolUseContentBlock:
+				toolUses = append(toolUses, b)
+			case TextContentBlock:
+				text.WriteString(b.Text)
+			}
+		}
+
+		if len(toolUses) != c.toolUses {
+			t.Errorf("%s: expected %d tool_use blocks, got %d", c.policy, c.toolUses, len(toolUses))
+			continue
+		}
+		if toolUses[0].Input["timeout"] != float64(60) {
+			t.Errorf("%s: expected timeout coerced to a number, got %#v", c.policy, toolUses[0].Input["timeout"])
+		}
+		if c.text != "" && !strings.Contains(text.String(), c.text) {
+			t.Errorf("%s: expected invalid tool call as text, got %q", c.policy, text.String())
+		}
+	}
+}
+
+// morphTextStream builds an upstream stream that generates the given text deltas
+func morphTextStream(deltas []string) string {
+	var upstream strings.Builder
+	upstream.WriteString("data: {\"type\":\"start\"}\n\ndata: {\"type\":\"text-start\",\"id\":\"0\"}\n\n")
+	for _, delta := range deltas {
+		data, _ := json.Marshal(map[string]string{"type": "text-delta", "id": "0", "delta": delta})
+		fmt.Fprintf(&upstream, "data: %s\n\n", data)
+	}
+	upstream.WriteString("data: {\"type\":\"text-end\",\"id\":\"0\"}\n\ndata: {\"type\":\"finish-step\"}\n\ndata: {\"type\":\"finish\",\"finishReason\":\"stop\"}\n\ndata: [DONE]\n\n")
+	return upstream.String()
+}
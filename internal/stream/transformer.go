@@ -5,16 +5,36 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"opus-api/internal/parser"
 	"opus-api/internal/tokenizer"
 	"opus-api/internal/types"
 	"strings"
 )
 
+// ErrStreamTruncated is returned when the upstream stream ends before the
+// message was finished
+var ErrStreamTruncated = errors.New("upstream stream ended unexpectedly")
+
+// TransformOptions describes the request a stream is answering
+type TransformOptions struct {
+	// Tools declared in the request. Tool inputs are coerced against their
+	// input_schema and, when any tools are declared, tool calls are
+	// validated and handled according to Policy.
+	Tools  parser.ToolSchemas
+	Policy types.ToolValidationPolicy // pass when empty
+
+	// ToolChoice of the request. Tool calls are stripped from the output
+	// when it is none, and only the first one is output when parallel tool
+	// use is disabled.
+	ToolChoice types.ToolChoice
+}
+
 // TransformMorphToClaudeStream transforms MorphLLM SSE stream to Claude SSE stream
-func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputTokens int, writer io.Writer, onChunk func(string)) error {
+func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputTokens int, options TransformOptions, writer io.Writer, onChunk func(string)) error {
 	scanner := bufio.NewScanner(morphStream)
 	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Increase buffer size
 
@@ -24,10 +44,18 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 	contentBlockClosed := false
 	messageDeltaSent := false
 	toolCallsEmitted := false
-	fullText := ""
+	outputText := ""
 	contentBlockIndex := 0
-	buffer := NewTextBuffer()
+	toolParser := parser.NewStreamParser()
 	nativeToolCalls := []types.ParsedToolCall{}
+	var activeTool *toolInputEncoder
+	var bufferedToolCall []parser.Event
+	skippingToolCall := false
+
+	// Invalid tool calls can only be dropped or turned into text if they are
+	// held back until complete, otherwise they are streamed as they arrive
+	validateToolCalls := len(options.Tools) > 0
+	bufferToolCalls := validateToolCalls && options.Policy != "" && options.Policy != types.ToolPolicyPass
 
 	emitSSE := func(event string, data interface{}) {
 		sseData := FormatSSE(event, data)
@@ -37,7 +65,7 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 		writer.Write([]byte(sseData))
 	}
 
-	emitToolCall := func(toolCall types.ParsedToolCall) {
+	openToolBlock := func(name string, input map[string]interface{}) {
 		// Close current text block if open
 		if contentBlockStarted && !contentBlockClosed {
 			emitSSE("content_block_stop", ContentBlockStopEvent{
@@ -46,7 +74,11 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 			})
 			contentBlockClosed = true
 		}
-		contentBlockIndex++
+		if contentBlockStarted {
+			contentBlockIndex++
+		}
+		contentBlockStarted = true
+		contentBlockClosed = false
 
 		toolUseID := "toolu_" + generateShortUUID()
 
@@ -56,29 +88,148 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 			ContentBlock: ToolUseContentBlock{
 				Type:  "tool_use",
 				ID:    toolUseID,
-				Name:  toolCall.Name,
-				Input: toolCall.Input,
+				Name:  name,
+				Input: input,
 			},
 		})
+	}
 
+	emitInputDelta := func(partialJSON string) {
+		if partialJSON == "" {
+			return
+		}
 		emitSSE("content_block_delta", ContentBlockDeltaEvent{
 			Type:  "content_block_delta",
 			Index: contentBlockIndex,
 			Delta: InputJSONDelta{
 				Type:        "input_json_delta",
-				PartialJSON: mustMarshalJSON(toolCall.Input),
+				PartialJSON: partialJSON,
 			},
 		})
+	}
 
+	closeToolBlock := func() {
 		emitSSE("content_block_stop", ContentBlockStopEvent{
 			Type:  "content_block_stop",
 			Index: contentBlockIndex,
 		})
-
-		contentBlockIndex++
+		contentBlockClosed = true
 		toolCallsEmitted = true
 	}
 
+	emitToolCall := func(toolCall types.ParsedToolCall) {
+		openToolBlock(toolCall.Name, toolCall.Input)
+		emitInputDelta(mustMarshalJSON(toolCall.Input))
+		closeToolBlock()
+	}
+
+	writeText := func(text string) {
+		// Open a text block if none is open
+		if !contentBlockStarted || contentBlockClosed {
+			if contentBlockStarted {
+				contentBlockIndex++
+			}
+			contentBlockStarted = true
+			contentBlockClosed = false
+			emitSSE("content_block_start", ContentBlockStartEvent{
+				Type:         "content_block_start",
+				Index:        contentBlockIndex,
+				ContentBlock: TextContentBlock{Type: "text", Text: ""},
+			})
+		}
+
+		emitSSE("content_block_delta", ContentBlockDeltaEvent{
+			Type:  "content_block_delta",
+			Index: contentBlockIndex,
+			Delta: TextDelta{Type: "text_delta", Text: text},
+		})
+	}
+
+	emitText := func(text string) {
+		// Text after tool calls is not output
+		if toolCallsEmitted || len(nativeToolCalls) > 0 {
+			return
+		}
+		writeText(text)
+	}
+
+	// emitBufferedToolCall validates a complete tool call and outputs it,
+	// drops it or returns it as text according to the policy
+	emitBufferedToolCall := func(events []parser.Event) {
+		encoder := newToolInputEncoder(events[0].Name, options.Tools)
+		for _, event := range events[1:] {
+			encoder.Handle(event)
+		}
+
+		problems := encoder.Problems()
+		if len(problems) == 0 {
+			openToolBlock(events[0].Name, map[string]interface{}{})
+			emitInputDelta(encoder.Flush())
+			closeToolBlock()
+			return
+		}
+
+		if options.Policy == types.ToolPolicyText {
+			log.Printf("[WARN] Returning tool call %s as text: %s", events[0].Name, strings.Join(problems, "; "))
+			writeText(toolCallText(events))
+			return
+		}
+		log.Printf("[WARN] Dropped tool call %s: %s", events[0].Name, strings.Join(problems, "; "))
+	}
+
+	// handleParserEvents outputs the text and tool calls recognized by the
+	// tool call parser. A tool_use block is opened as soon as its invoke tag
+	// arrives and the input is streamed as it is generated.
+	handleParserEvents := func(events []parser.Event) {
+		for _, event := range events {
+			if skippingToolCall {
+				skippingToolCall = event.Type != parser.EventToolEnd
+				continue
+			}
+			if bufferedToolCall != nil {
+				bufferedToolCall = append(bufferedToolCall, event)
+				if event.Type == parser.EventToolEnd {
+					emitBufferedToolCall(bufferedToolCall)
+					bufferedToolCall = nil
+				}
+				continue
+			}
+
+			switch event.Type {
+			case parser.EventText:
+				emitText(event.Text)
+			case parser.EventToolStart:
+				if options.ToolChoice.Type == types.ToolChoiceNone || (options.ToolChoice.DisableParallelToolUse && toolCallsEmitted) {
+					skippingToolCall = true
+					continue
+				}
+				if bufferToolCalls {
+					bufferedToolCall = []parser.Event{event}
+					continue
+				}
+				openToolBlock(event.Name, map[string]interface{}{})
+				activeTool = newToolInputEncoder(event.Name, options.Tools)
+			case parser.EventToolEnd:
+				activeTool.Close()
+				emitInputDelta(activeTool.Flush())
+				closeToolBlock()
+				if validateToolCalls {
+					if problems := activeTool.Problems(); len(problems) > 0 {
+						log.Printf("[WARN] Tool call %s: %s", activeTool.tool, strings.Join(problems, "; "))
+					}
+				}
+				activeTool = nil
+			default:
+				activeTool.Handle(event)
+			}
+		}
+
+		// Send the input generated so far as one delta
+		if activeTool != nil {
+			emitInputDelta(activeTool.Flush())
+		}
+	}
+
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -90,8 +241,10 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 		dataStr = strings.TrimSpace(dataStr)
 
 		if dataStr == "[DONE]" {
+			handleParserEvents(toolParser.Finish())
+
 			// Calculate output tokens from accumulated text
-			outputTokens := tokenizer.CountTokens(fullText)
+			outputTokens := tokenizer.CountTokens(outputText)
 
 			// Handle [DONE]
 			if toolCallsEmitted {
@@ -114,6 +267,9 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 			if len(nativeToolCalls) > 0 {
 				for _, toolCall := range nativeToolCalls {
 					emitToolCall(toolCall)
+					if options.ToolChoice.DisableParallelToolUse {
+						break
+					}
 				}
 				if !messageDeltaSent {
 					emitSSE("message_delta", MessageDeltaEvent{
@@ -130,17 +286,6 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 				continue
 			}
 
-			// No tool calls, flush remaining text
-			if !buffer.IsEmpty() {
-				buffer.FlushAll(func(text string) {
-					emitSSE("content_block_delta", ContentBlockDeltaEvent{
-						Type:  "content_block_delta",
-						Index: contentBlockIndex,
-						Delta: TextDelta{Type: "text_delta", Text: text},
-					})
-				})
-			}
-
 			// Close text content block if open
 			if contentBlockStarted && !contentBlockClosed {
 				emitSSE("content_block_stop", ContentBlockStopEvent{
@@ -214,129 +359,32 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 
 		case "text-delta":
 			delta, _ := data["delta"].(string)
-			fullText += delta
-
-			// If tool calls already emitted, ignore subsequent text
-			if toolCallsEmitted {
-				continue
-			}
-
-			// If content block closed, reopen it
-			if contentBlockClosed {
-				contentBlockIndex++
-				contentBlockClosed = false
-				emitSSE("content_block_start", ContentBlockStartEvent{
-					Type:         "content_block_start",
-					Index:        contentBlockIndex,
-					ContentBlock: TextContentBlock{Type: "text", Text: ""},
-				})
-			}
-
-			buffer.Add(delta)
-
-			// Stream processing: emit tool calls one by one as they complete
-			for {
-				result := parser.ParseNextToolCall(fullText)
-				if !result.Found {
-					break
-				}
-
-				// Output text before tool call
-				textBefore := fullText[:strings.Index(fullText, "<invoke")]
-				if textBefore != "" && !buffer.ToolCallDetected {
-					emitSSE("content_block_delta", ContentBlockDeltaEvent{
-						Type:  "content_block_delta",
-						Index: contentBlockIndex,
-						Delta: TextDelta{Type: "text_delta", Text: textBefore},
-					})
-				}
-				buffer.Clear()
-				buffer.ToolCallDetected = true
-
-				// Emit single tool call immediately
-				emitToolCall(*result.ToolCall)
-
-				// Remove processed part from fullText
-				fullText = fullText[result.EndPosition:]
-			}
-
-			// Check for incomplete tool call
-			if parser.HasIncompleteToolCall(fullText) {
-				buffer.ToolCallDetected = true
-				buffer.Clear()
-			} else if !buffer.ToolCallDetected {
-				// No tool call, output text normally
-				buffer.FlushSafeText(func(text string) {
-					emitSSE("content_block_delta", ContentBlockDeltaEvent{
-						Type:  "content_block_delta",
-						Index: contentBlockIndex,
-						Delta: TextDelta{Type: "text_delta", Text: text},
-					})
-				})
-			}
+			outputText += delta
+			handleParserEvents(toolParser.Feed(delta))
 
 		case "text-end":
-			// text-end indicates current text segment ended
-			result := parser.ParseToolCalls(fullText)
-
-			if len(result.ToolCalls) == 0 {
-				// No tool calls, output all remaining text
-				if !buffer.IsEmpty() {
-					buffer.FlushAll(func(text string) {
-						emitSSE("content_block_delta", ContentBlockDeltaEvent{
-							Type:  "content_block_delta",
-							Index: contentBlockIndex,
-							Delta: TextDelta{Type: "text_delta", Text: text},
-						})
-					})
-				}
-			}
+			// text-end indicates current text segment ended, the parser keeps
+			// incomplete tags until the step finishes
 
 		case "finish-step":
-			// MorphLLM finish-step indicates a step completed
-			// Check for tool calls at step boundary
-			result := parser.ParseToolCalls(fullText)
-			if len(result.ToolCalls) > 0 && !toolCallsEmitted {
-				// Output remaining text before tool calls
-				if result.RemainingText != "" && !buffer.ToolCallDetected {
-					emitSSE("content_block_delta", ContentBlockDeltaEvent{
-						Type:  "content_block_delta",
-						Index: contentBlockIndex,
-						Delta: TextDelta{Type: "text_delta", Text: result.RemainingText},
-					})
-				}
-				buffer.Clear()
-				buffer.ToolCallDetected = true
-
-				// Emit tool calls
-				for _, toolCall := range result.ToolCalls {
-					emitToolCall(toolCall)
-				}
-			} else if !buffer.IsEmpty() && !buffer.ToolCallDetected {
-				// No tool calls, flush remaining text
-				buffer.FlushAll(func(text string) {
-					emitSSE("content_block_delta", ContentBlockDeltaEvent{
-						Type:  "content_block_delta",
-						Index: contentBlockIndex,
-						Delta: TextDelta{Type: "text_delta", Text: text},
-					})
-				})
-			}
+			// MorphLLM finish-step indicates a step completed, flush the parser
+			// and close a tool call whose </invoke> never arrived
+			handleParserEvents(toolParser.Finish())
 
 		case "start-step":
 			// MorphLLM start-step indicates new step started
 			// No special handling needed
 
 		case "finish":
-			result := parser.ParseToolCalls(fullText)
+			handleParserEvents(toolParser.Finish())
 
 			finishReason, _ := data["finishReason"].(string)
-			if len(result.ToolCalls) == 0 && finishReason != "tool-calls" && !messageDeltaSent {
+			if !toolCallsEmitted && finishReason != "tool-calls" && !messageDeltaSent {
 				stopReason := "end_turn"
 				if finishReason != "" && finishReason != "stop" {
 					stopReason = finishReason
 				}
-				outputTokens := tokenizer.CountTokens(fullText)
+				outputTokens := tokenizer.CountTokens(outputText)
 				emitSSE("message_delta", MessageDeltaEvent{
 					Type: "message_delta",
 					Delta: map[string]interface{}{
@@ -352,12 +400,11 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 			// Capture MorphLLM native tool calls (when tool unavailable)
 			toolName, _ := data["toolName"].(string)
 			input, _ := data["input"].(map[string]interface{})
-			if toolName != "" && input != nil {
+			if toolName != "" && input != nil && options.ToolChoice.Type != types.ToolChoiceNone {
 				nativeToolCalls = append(nativeToolCalls, types.ParsedToolCall{
 					Name:  toolName,
 					Input: input,
 				})
-				buffer.ToolCallDetected = true
 			}
 		}
 	}
@@ -366,6 +413,11 @@ func TransformMorphToClaudeStream(morphStream io.Reader, model string, inputToke
 		return err
 	}
 
+	// Upstream closed the stream before finishing the message
+	if !messageDeltaSent {
+		return ErrStreamTruncated
+	}
+
 	return nil
 }
 
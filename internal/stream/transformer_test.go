@@ -23,7 +23,7 @@ func TestTransformMorphToClaudeStream_IncompleteToolCall(t *testing.T) {
 	var output bytes.Buffer
 
 	// Transform
-	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err = TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Errorf("Transform failed: %v", err)
 	}
@@ -90,7 +90,7 @@ data: [DONE]
 	input := strings.NewReader(testData)
 	var output bytes.Buffer
 
-	err := TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, &output, nil)
+	err := TransformMorphToClaudeStream(input, "claude-sonnet-4-5", 0, TransformOptions{}, &output, nil)
 	if err != nil {
 		t.Fatalf("Transform failed: %v", err)
 	}
@@ -0,0 +1,52 @@
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// UsageCounter watches the Claude SSE events written by
+// TransformMorphToClaudeStream and records the output token count reported
+// in message_delta. It is safe to read while the stream is still running.
+type UsageCounter struct {
+	events       *EventWriter
+	mu           sync.Mutex
+	outputTokens int
+}
+
+// NewUsageCounter creates a UsageCounter
+func NewUsageCounter() *UsageCounter {
+	u := &UsageCounter{}
+	u.events = NewEventWriter(u.handleEvent)
+	return u
+}
+
+// Write parses the SSE frames in p
+func (u *UsageCounter) Write(p []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.events.Write(p)
+}
+
+func (u *UsageCounter) handleEvent(event string, data []byte) {
+	if event != "message_delta" {
+		return
+	}
+	var ev struct {
+		Usage map[string]int `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return
+	}
+	if tokens, ok := ev.Usage["output_tokens"]; ok {
+		u.outputTokens = tokens
+	}
+}
+
+// OutputTokens returns the output token count seen so far, 0 if the stream
+// has not reached message_delta
+func (u *UsageCounter) OutputTokens() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.outputTokens
+}
@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestUsageCounter tests that the output tokens of the transformed stream are recorded
+func TestUsageCounter(t *testing.T) {
+	testData := `data: {"type":"start"}
+
+data: {"type":"text-start","id":"0"}
+
+data: {"type":"text-delta","id":"0","delta":"Hello world"}
+
+data: {"type":"text-end","id":"0"}
+
+data: {"type":"finish","finishReason":"stop"}
+
+data: [DONE]
+
+`
+
+	counter := NewUsageCounter()
+	accumulator := NewMessageAccumulator("claude-opus-4-5-20251101", 12)
+	w := io.MultiWriter(accumulator, counter)
+	if err := TransformMorphToClaudeStream(strings.NewReader(testData), "claude-opus-4-5-20251101", 12, TransformOptions{}, w, nil); err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	want := accumulator.Message().Usage["output_tokens"]
+	if want == 0 {
+		t.Fatal("Expected the stream to report output tokens")
+	}
+	if got := counter.OutputTokens(); got != want {
+		t.Errorf("Expected %d output tokens, got %d", want, got)
+	}
+}
@@ -43,18 +43,31 @@ type ClaudeContentBlockText struct {
 
 func (c ClaudeContentBlockText) GetType() string { return c.Type }
 
+// ClaudeMediaSource is the source of an image or document block
+type ClaudeMediaSource struct {
+	Type      string `json:"type"` // "base64", "url" or "text" (documents only)
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
 // ClaudeContentBlockImage represents image content
 type ClaudeContentBlockImage struct {
-	Type   string `json:"type"` // "image"
-	Source struct {
-		Type      string `json:"type"` // "base64"
-		MediaType string `json:"media_type"`
-		Data      string `json:"data"`
-	} `json:"source"`
+	Type   string            `json:"type"` // "image"
+	Source ClaudeMediaSource `json:"source"`
 }
 
 func (c ClaudeContentBlockImage) GetType() string { return c.Type }
 
+// ClaudeContentBlockDocument represents document content, such as a PDF
+type ClaudeContentBlockDocument struct {
+	Type   string            `json:"type"` // "document"
+	Source ClaudeMediaSource `json:"source"`
+	Title  string            `json:"title,omitempty"`
+}
+
+func (c ClaudeContentBlockDocument) GetType() string { return c.Type }
+
 // ClaudeContentBlockToolUse represents tool use
 type ClaudeContentBlockToolUse struct {
 	Type  string                 `json:"type"` // "tool_use"
@@ -75,6 +88,37 @@ type ClaudeContentBlockToolResult struct {
 
 func (c ClaudeContentBlockToolResult) GetType() string { return c.Type }
 
+// UnmarshalJSON decodes an array content into content blocks, like
+// ClaudeMessage.Content
+func (c *ClaudeContentBlockToolResult) UnmarshalJSON(data []byte) error {
+	type Alias ClaudeContentBlockToolResult
+	aux := &struct {
+		Content json.RawMessage `json:"content"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(aux.Content, &blocks); err == nil {
+		c.Content = parseContentBlocks(blocks)
+		return nil
+	}
+
+	var content interface{}
+	if len(aux.Content) > 0 {
+		if err := json.Unmarshal(aux.Content, &content); err != nil {
+			return err
+		}
+	}
+	c.Content = content
+	return nil
+}
+
 // ClaudeTool represents a tool definition
 type ClaudeTool struct {
 	Name        string                 `json:"name"`
@@ -82,6 +126,49 @@ type ClaudeTool struct {
 	InputSchema map[string]interface{} `json:"input_schema"`
 }
 
+// Tool choice types
+const (
+	ToolChoiceAuto = "auto" // the model decides whether to call tools
+	ToolChoiceAny  = "any"  // the model must call at least one tool
+	ToolChoiceTool = "tool" // the model must call the named tool
+	ToolChoiceNone = "none" // the model must not call tools
+)
+
+// ToolChoice is the parsed tool_choice of a request
+type ToolChoice struct {
+	Type                   string
+	Name                   string // the tool to call when Type is "tool"
+	DisableParallelToolUse bool
+}
+
+// RequiresToolCall reports whether the response must contain a tool call
+func (t ToolChoice) RequiresToolCall() bool {
+	return t.Type == ToolChoiceAny || t.Type == ToolChoiceTool
+}
+
+// GetToolChoice parses tool_choice. A missing or unknown choice is auto, and
+// a "tool" choice without a name is treated as "any".
+func (r ClaudeRequest) GetToolChoice() ToolChoice {
+	choice := ToolChoice{Type: ToolChoiceAuto}
+	m, ok := r.ToolChoice.(map[string]interface{})
+	if !ok {
+		return choice
+	}
+
+	choice.DisableParallelToolUse, _ = m["disable_parallel_tool_use"].(bool)
+	switch t, _ := m["type"].(string); t {
+	case ToolChoiceAny, ToolChoiceNone:
+		choice.Type = t
+	case ToolChoiceTool:
+		choice.Type = ToolChoiceAny
+		if name, _ := m["name"].(string); name != "" {
+			choice.Type = ToolChoiceTool
+			choice.Name = name
+		}
+	}
+	return choice
+}
+
 // UnmarshalJSON custom unmarshaler for ClaudeMessage.Content
 func (m *ClaudeMessage) UnmarshalJSON(data []byte) error {
 	type Alias ClaudeMessage
@@ -109,6 +196,12 @@ func (m *ClaudeMessage) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	m.Content = parseContentBlocks(blocks)
+	return nil
+}
+
+// parseContentBlocks decodes content blocks by type, skipping unknown types
+func parseContentBlocks(blocks []json.RawMessage) []ClaudeContentBlock {
 	var contentBlocks []ClaudeContentBlock
 	for _, block := range blocks {
 		var typeCheck struct {
@@ -129,6 +222,11 @@ func (m *ClaudeMessage) UnmarshalJSON(data []byte) error {
 			if err := json.Unmarshal(block, &imageBlock); err == nil {
 				contentBlocks = append(contentBlocks, imageBlock)
 			}
+		case "document":
+			var documentBlock ClaudeContentBlockDocument
+			if err := json.Unmarshal(block, &documentBlock); err == nil {
+				contentBlocks = append(contentBlocks, documentBlock)
+			}
 		case "tool_use":
 			var toolUseBlock ClaudeContentBlockToolUse
 			if err := json.Unmarshal(block, &toolUseBlock); err == nil {
@@ -142,6 +240,5 @@ func (m *ClaudeMessage) UnmarshalJSON(data []byte) error {
 		}
 	}
 
-	m.Content = contentBlocks
-	return nil
+	return contentBlocks
 }
\ No newline at end of file
@@ -1,8 +1,7 @@
 package types
 
 import (
-	"errors"
-	"strings"
+	"time"
 )
 
 const (
@@ -30,21 +29,70 @@ var MorphHeaders = map[string]string{
 
 var DebugMode = true
 
+// ========== 上游重试配置 ==========
+
+// UpstreamMaxAttempts 单个请求最多尝试的 Cookie 数量（UPSTREAM_MAX_ATTEMPTS）
+var UpstreamMaxAttempts = 3
+
+// UpstreamRetryDeadline 所有尝试的总时限（UPSTREAM_RETRY_DEADLINE，单位秒）
+var UpstreamRetryDeadline = 60 * time.Second
+
+// ========== 工具调用校验配置 ==========
+
+// ToolValidationPolicy 工具调用校验失败（工具未声明、缺少必填参数或参数值不符合 schema）时的处理方式
+type ToolValidationPolicy string
+
+const (
+	ToolPolicyPass ToolValidationPolicy = "pass" // 原样返回工具调用，只记录日志
+	ToolPolicyDrop ToolValidationPolicy = "drop" // 丢弃工具调用
+	ToolPolicyText ToolValidationPolicy = "text" // 把工具调用的 XML 作为文本返回
+)
+
+// ToolPolicy 工具调用校验策略（TOOL_VALIDATION_POLICY）
+var ToolPolicy = ToolPolicyPass
+
+// ========== 图片和文档配置 ==========
+
+// ImageMode 消息中的图片和 PDF 等文档的处理方式
+type ImageMode string
+
+const (
+	ImageModeForward     ImageMode = "forward"     // 作为 file 类型的 part 转发给上游
+	ImageModePlaceholder ImageMode = "placeholder" // 替换为说明文字
+	ImageModeReject      ImageMode = "reject"      // 拒绝请求（invalid_request_error）
+)
+
+// ImageHandling 图片和文档的处理方式（IMAGE_MODE）
+var ImageHandling = ImageModePlaceholder
+
+// PoolScope Cookie 池范围
+type PoolScope string
+
+const (
+	PoolScopeDefault PoolScope = ""       // 用户自己的 Cookie，没有可用的时使用共享池
+	PoolScopeUser    PoolScope = "user"   // 只使用用户自己的 Cookie
+	PoolScopeShared  PoolScope = "shared" // 只使用共享池中的 Cookie
+	PoolScopeGroup   PoolScope = "group"  // 只使用指定名称的池中共享的或属于该用户的 Cookie
+)
+
+// CookieSelector 描述一次 Cookie 选择的约束条件
+type CookieSelector struct {
+	ExcludeIDs  []uint    // 本次请求中已经尝试失败的 Cookie
+	Scope       PoolScope // Cookie 池范围
+	UserID      uint      // 请求所属的用户，0 表示匿名请求（只能使用共享池）
+	Pool        string    // 指定的池名称，为空时使用默认池；Scope 为 user 时只使用用户自己在该池中的 Cookie
+	PoolBound   bool      // 池由 API Key 绑定，该池没有可用的 Cookie 时不回退到默认池
+	AffinityKey string    // 会话亲和键，同一会话的请求尽量使用同一个 Cookie；为空时不绑定
+}
+
 // CookieRotatorInstance is a global reference to the cookie rotator service
 // It's set in main.go after initialization
 var CookieRotatorInstance interface {
-	NextCookie() (cookie interface{}, err error)
-	MarkUsed(cookieID uint) error
-	MarkError(cookieID uint) error
-}
-
-// GetNextCookieFromRotator 从轮询器获取下一个 Cookie
-// 这是一个辅助函数，用于从全局轮询器实例获取 Cookie
-func GetNextCookieFromRotator() (interface{}, error) {
-	if CookieRotatorInstance == nil {
-		return nil, errors.New("cookie rotator not initialized")
-	}
-	return CookieRotatorInstance.NextCookie()
+	NextCookie(selector CookieSelector) (cookie interface{}, err error)
+	MarkUsed(cookieID uint, ttfb time.Duration) error
+	MarkError(cookieID uint, statusCode int, reason string) error
+	MarkInvalid(cookieID uint, reason string) error
+	Release(cookieID uint, tokens int)
 }
 
 type ParsedToolCall struct {
@@ -57,22 +105,13 @@ type ParsedToolCall struct {
 // DefaultModel 默认使用的模型
 const DefaultModel = "claude-opus-4-5-20251101"
 
-// SupportedModels 支持的模型列表
-var SupportedModels = []string{
-	"claude-opus-4-5-20251101",
-}
-
-// IsModelSupported 检查模型是否在支持列表中
+// IsModelSupported 检查模型（ID 或别名）是否在模型注册表中
 func IsModelSupported(model string) bool {
 	if model == "" {
 		return false
 	}
-	for _, supported := range SupportedModels {
-		if strings.EqualFold(supported, model) {
-			return true
-		}
-	}
-	return false
+	_, ok := Models.Resolve(model)
+	return ok
 }
 
 // ========== 认证请求/响应类型 ==========
@@ -0,0 +1,136 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ModelInfo 模型配置，描述一个对外公开的模型及其上游行为
+type ModelInfo struct {
+	ID              string   `json:"id"`
+	DisplayName     string   `json:"display_name"`
+	Aliases         []string `json:"aliases,omitempty"`
+	CreatedAt       string   `json:"created_at"`
+	ContextWindow   int      `json:"context_window"`
+	MaxOutputTokens int      `json:"max_output_tokens"`
+	// UpstreamModel 在上游身份提示中声明的模型 ID，为空时使用 ID
+	UpstreamModel string `json:"upstream_model,omitempty"`
+	// CookiePool 该模型的请求使用的 Cookie 池，为空时使用默认池
+	CookiePool string `json:"cookie_pool,omitempty"`
+}
+
+// GetUpstreamModel 返回发送给上游的模型 ID
+func (m ModelInfo) GetUpstreamModel() string {
+	if m.UpstreamModel != "" {
+		return m.UpstreamModel
+	}
+	return m.ID
+}
+
+// ModelRegistry 模型注册表，支持通过 ID 或别名查找模型
+type ModelRegistry struct {
+	models []ModelInfo
+	index  map[string]int // 小写的 ID/别名 -> models 下标
+}
+
+// DefaultModels 内置模型配置（未提供配置文件时使用）
+var DefaultModels = []ModelInfo{
+	{
+		ID:              "claude-opus-4-5-20251101",
+		DisplayName:     "Claude Opus 4.5",
+		Aliases:         []string{"claude-opus-4-5", "claude-opus-4-5-latest", "claude-3-opus-latest"},
+		CreatedAt:       "2025-11-01T00:00:00Z",
+		ContextWindow:   200000,
+		MaxOutputTokens: 64000,
+	},
+}
+
+// Models 全局模型注册表，在 main.go 中根据配置加载
+var Models = mustNewModelRegistry(DefaultModels)
+
+// NewModelRegistry 创建模型注册表，ID 和别名不能重复
+func NewModelRegistry(models []ModelInfo) (*ModelRegistry, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("model registry is empty")
+	}
+
+	registry := &ModelRegistry{
+		models: make([]ModelInfo, 0, len(models)),
+		index:  make(map[string]int),
+	}
+	for _, model := range models {
+		if model.ID == "" {
+			return nil, fmt.Errorf("model without id")
+		}
+		if model.DisplayName == "" {
+			model.DisplayName = model.ID
+		}
+		position := len(registry.models)
+		for _, name := range append([]string{model.ID}, model.Aliases...) {
+			key := strings.ToLower(name)
+			if _, exists := registry.index[key]; exists {
+				return nil, fmt.Errorf("duplicate model id or alias %q", name)
+			}
+			registry.index[key] = position
+		}
+		registry.models = append(registry.models, model)
+	}
+	return registry, nil
+}
+
+func mustNewModelRegistry(models []ModelInfo) *ModelRegistry {
+	registry, err := NewModelRegistry(models)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// LoadModelRegistry 从 JSON 配置文件加载模型注册表
+// 文件格式为 ModelInfo 数组，或 {"models": [...]}
+func LoadModelRegistry(path string) (*ModelRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []ModelInfo
+	if err := json.Unmarshal(data, &models); err != nil {
+		var wrapped struct {
+			Models []ModelInfo `json:"models"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("invalid model config %s: %w", path, err)
+		}
+		models = wrapped.Models
+	}
+
+	return NewModelRegistry(models)
+}
+
+// Resolve 通过 ID 或别名查找模型（不区分大小写）
+func (r *ModelRegistry) Resolve(name string) (ModelInfo, bool) {
+	position, ok := r.index[strings.ToLower(name)]
+	if !ok {
+		return ModelInfo{}, false
+	}
+	return r.models[position], true
+}
+
+// List 按配置顺序返回所有模型
+func (r *ModelRegistry) List() []ModelInfo {
+	models := make([]ModelInfo, len(r.models))
+	copy(models, r.models)
+	return models
+}
+
+// IDs 返回所有模型的 ID
+func (r *ModelRegistry) IDs() []string {
+	ids := make([]string, len(r.models))
+	for i, model := range r.models {
+		ids[i] = model.ID
+	}
+	return ids
+}
@@ -0,0 +1,35 @@
+package types
+
+import "testing"
+
+func TestModelRegistryResolveAlias(t *testing.T) {
+	registry, err := NewModelRegistry(DefaultModels)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	for _, name := range []string{"claude-opus-4-5-20251101", "claude-opus-4-5", "CLAUDE-3-OPUS-LATEST"} {
+		model, ok := registry.Resolve(name)
+		if !ok {
+			t.Errorf("Expected '%s' to resolve", name)
+			continue
+		}
+		if model.ID != "claude-opus-4-5-20251101" {
+			t.Errorf("Expected '%s' to resolve to claude-opus-4-5-20251101, got '%s'", name, model.ID)
+		}
+	}
+
+	if _, ok := registry.Resolve("gpt-4"); ok {
+		t.Error("Unknown model should not resolve")
+	}
+}
+
+func TestModelRegistryDuplicateAlias(t *testing.T) {
+	_, err := NewModelRegistry([]ModelInfo{
+		{ID: "model-a", Aliases: []string{"shared"}},
+		{ID: "model-b", Aliases: []string{"shared"}},
+	})
+	if err == nil {
+		t.Error("Expected duplicate alias to be rejected")
+	}
+}
@@ -19,7 +19,12 @@ type MorphMessage struct {
 
 // MorphPart represents a part of a message
 type MorphPart struct {
-	Type  string `json:"type"` // "text"
+	Type  string `json:"type"` // "text" or "file"
 	Text  string `json:"text"`
-	State string `json:"state"` // "done" or "pending"
+	State string `json:"state,omitempty"` // "done" or "pending"
+
+	// File parts only
+	MediaType string `json:"mediaType,omitempty"`
+	URL       string `json:"url,omitempty"` // data URL for inline content
+	Filename  string `json:"filename,omitempty"`
 }
@@ -0,0 +1,107 @@
+package types
+
+// OpenAIChatRequest represents an OpenAI Chat Completions request
+type OpenAIChatRequest struct {
+	Model               string                 `json:"model"`
+	Messages            []OpenAIMessage        `json:"messages"`
+	Tools               []OpenAITool           `json:"tools,omitempty"`
+	ToolChoice          interface{}            `json:"tool_choice,omitempty"` // "none" | "auto" | "required" | {"type":"function","function":{"name":...}}
+	ParallelToolCalls   *bool                  `json:"parallel_tool_calls,omitempty"`
+	Stream              bool                   `json:"stream,omitempty"`
+	StreamOptions       *OpenAIStreamOptions   `json:"stream_options,omitempty"`
+	MaxTokens           int                    `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                    `json:"max_completion_tokens,omitempty"`
+	Temperature         float64                `json:"temperature,omitempty"`
+	TopP                float64                `json:"top_p,omitempty"`
+	User                string                 `json:"user,omitempty"`
+	Metadata            map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// OpenAIStreamOptions represents stream_options
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIMessage represents a message in the OpenAI API
+type OpenAIMessage struct {
+	Role       string           `json:"role"`              // "system", "developer", "user", "assistant" or "tool"
+	Content    interface{}      `json:"content,omitempty"` // string or []OpenAIContentPart
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIToolCall represents a tool call made by the assistant
+type OpenAIToolCall struct {
+	Index    *int               `json:"index,omitempty"` // only set in stream chunks
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"` // "function"
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIFunctionCall represents the function part of a tool call
+type OpenAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// OpenAITool represents a tool definition
+type OpenAITool struct {
+	Type     string         `json:"type"` // "function"
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction represents a function definition
+type OpenAIFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// OpenAIChatCompletion represents a non-streaming chat completion
+type OpenAIChatCompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"` // "chat.completion"
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+}
+
+// OpenAIChoice represents a choice in a chat completion
+type OpenAIChoice struct {
+	Index        int           `json:"index"`
+	Message      OpenAIMessage `json:"message"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+// OpenAIChatCompletionChunk represents a streaming chat completion chunk
+type OpenAIChatCompletionChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"` // "chat.completion.chunk"
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []OpenAIChunkChoice `json:"choices"`
+	Usage   *OpenAIUsage        `json:"usage,omitempty"`
+}
+
+// OpenAIChunkChoice represents a choice in a stream chunk
+type OpenAIChunkChoice struct {
+	Index        int              `json:"index"`
+	Delta        OpenAIChunkDelta `json:"delta"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+// OpenAIChunkDelta represents the delta of a stream chunk
+type OpenAIChunkDelta struct {
+	Role      string           `json:"role,omitempty"`
+	Content   *string          `json:"content,omitempty"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+}
+
+// OpenAIUsage represents token usage
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
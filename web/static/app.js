@@ -4,6 +4,9 @@ const API_BASE = window.location.origin;
 // 存储认证 token
 let authToken = localStorage.getItem('auth_token');
 
+// 当前用户是否是管理员，非管理员不显示全局设置
+let isAdmin = false;
+
 // 页面加载时检查认证状态
 document.addEventListener('DOMContentLoaded', function() {
     const currentPage = window.location.pathname;
@@ -29,6 +32,12 @@ document.addEventListener('DOMContentLoaded', function() {
     }
 });
 
+// 从错误响应中取出错误信息 ({"type":"error","error":{"type":...,"message":...}})
+function errorMessage(data) {
+    if (!data || !data.error) return '';
+    return typeof data.error === 'string' ? data.error : data.error.message;
+}
+
 // ========== 认证功能 ==========
 
 // 设置登录表单
@@ -65,7 +74,7 @@ function setupLoginForm() {
                     localStorage.setItem('auth_token', authToken);
                     window.location.href = '/dashboard';
                 } else {
-                    errorDiv.textContent = data.error || '登录失败';
+                    errorDiv.textContent = errorMessage(data) || '登录失败';
                     errorDiv.style.display = 'block';
                 }
             } catch (error) {
@@ -114,7 +123,7 @@ async function changePassword(oldPassword, newPassword) {
             return true;
         } else {
             const data = await response.json();
-            return { error: data.error || '密码修改失败' };
+            return { error: errorMessage(data) || '密码修改失败' };
         }
     } catch (error) {
         console.error('修改密码错误:', error);
@@ -193,7 +202,10 @@ async function loadDashboard() {
     setupChangePasswordForm();
     await loadUserInfo();
     await loadStats();
+    await loadStrategy();
     await loadCookies();
+    await loadPools();
+    await loadAPIKeys();
 }
 
 // 加载用户信息
@@ -203,6 +215,9 @@ async function loadUserInfo() {
         if (response.ok) {
             const user = await response.json();
             document.getElementById('currentUser').textContent = user.username;
+            isAdmin = user.is_admin;
+            document.getElementById('strategyControl').style.display = isAdmin ? '' : 'none';
+            document.getElementById('keyAllowCookieOverrideField').style.display = isAdmin ? '' : 'none';
         }
     } catch (error) {
         console.error('加载用户信息失败:', error);
@@ -218,6 +233,8 @@ async function loadStats() {
             document.getElementById('totalCount').textContent = stats.total_count;
             document.getElementById('validCount').textContent = stats.valid_count;
             document.getElementById('invalidCount').textContent = stats.invalid_count;
+            document.getElementById('coolingCount').textContent = stats.cooling_count || 0;
+            document.getElementById('inFlightCount').textContent = stats.in_flight || 0;
             document.getElementById('totalUsage').textContent = stats.total_usage.toLocaleString();
         }
     } catch (error) {
@@ -255,13 +272,17 @@ function renderCookieTable(cookies) {
     tbody.innerHTML = cookies.map((cookie, index) => `
         <tr>
             <td>${index + 1}</td>
-            <td>${escapeHtml(cookie.name)}</td>
             <td>
-                <span class="status-badge ${cookie.is_valid ? 'status-valid' : 'status-invalid'}">
-                    ${cookie.is_valid ? '✅ 有效' : '❌ 无效'}
-                </span>
+                ${escapeHtml(cookie.name)}
+                ${cookie.last_error && (cookie.cooling_down || !cookie.is_valid) ? `
+                    <div class="cookie-error" title="${escapeHtml(cookie.last_error)}">
+                        ${escapeHtml(cookie.last_error)}
+                    </div>` : ''}
             </td>
+            <td>${escapeHtml(cookie.pool || 'default')}</td>
+            <td>${renderCookieStatus(cookie)}</td>
             <td>${(cookie.usage_count || 0).toLocaleString()}</td>
+            <td>${renderCookieLoad(cookie)}</td>
             <td>${cookie.priority || 0}</td>
             <td>${formatTime(cookie.last_validated)}</td>
             <td>
@@ -275,10 +296,164 @@ function renderCookieTable(cookies) {
     `).join('');
 }
 
+// 渲染 Cookie 负载和限流设置，上限为 0 表示不限制
+function renderCookieLoad(cookie) {
+    const limit = value => value ? ` / ${value.toLocaleString()}` : '';
+    return `<div class="cookie-load">
+        <div>并发 ${cookie.in_flight || 0}${limit(cookie.max_concurrent)}</div>
+        <div>今日 Token ${(cookie.tokens_today || 0).toLocaleString()}${limit(cookie.daily_token_limit)}</div>
+        ${cookie.rpm_limit ? `<div>${cookie.rpm_limit} 次/分钟</div>` : ''}
+    </div>`;
+}
+
+// 渲染 Cookie 状态
+function renderCookieStatus(cookie) {
+    if (!cookie.is_valid) {
+        return '<span class="status-badge status-invalid">❌ 无效</span>';
+    }
+    if (cookie.cooling_down) {
+        return `<span class="status-badge status-cooling" data-cooldown-until="${cookie.cooldown_until}">
+            ⏳ 冷却中 ${formatCountdown(cookie.cooldown_until)}
+        </span>`;
+    }
+    return '<span class="status-badge status-valid">✅ 有效</span>';
+}
+
+// 冷却剩余时间
+function formatCountdown(until) {
+    const remaining = Math.max(0, Math.ceil((new Date(until) - new Date()) / 1000));
+    const minutes = Math.floor(remaining / 60);
+    const seconds = remaining % 60;
+    return `${minutes}:${String(seconds).padStart(2, '0')}`;
+}
+
+// 每秒更新冷却倒计时，冷却结束后刷新列表
+setInterval(() => {
+    const badges = document.querySelectorAll('[data-cooldown-until]');
+    let expired = false;
+    badges.forEach(badge => {
+        const until = badge.dataset.cooldownUntil;
+        badge.textContent = `⏳ 冷却中 ${formatCountdown(until)}`;
+        if (new Date(until) <= new Date()) {
+            // 只触发一次刷新，由服务端给出最新状态
+            delete badge.dataset.cooldownUntil;
+            expired = true;
+        }
+    });
+    if (expired) {
+        refreshCookies();
+    }
+}, 1000);
+
 // 刷新 Cookie 列表
 function refreshCookies() {
     loadCookies();
     loadStats();
+    loadPools();
+}
+
+// ========== 轮询策略 ==========
+
+// 策略显示名称
+const STRATEGY_LABELS = {
+    round_robin: '轮询',
+    priority: '优先级',
+    least_used: '最少使用',
+    weighted: '加权轮询',
+    fastest: '延迟最低'
+};
+
+// 加载轮询策略
+async function loadStrategy() {
+    try {
+        const response = await apiRequest('/api/rotation/strategy');
+        if (response.ok) {
+            renderStrategy(await response.json());
+        }
+    } catch (error) {
+        console.error('加载轮询策略失败:', error);
+    }
+}
+
+// 渲染轮询策略选择框
+function renderStrategy(data) {
+    const select = document.getElementById('rotationStrategy');
+    select.innerHTML = data.available.map(strategy => `
+        <option value="${strategy}" ${strategy === data.strategy ? 'selected' : ''}>
+            ${STRATEGY_LABELS[strategy] || strategy}
+        </option>
+    `).join('');
+}
+
+// 修改轮询策略
+async function updateStrategy(strategy) {
+    try {
+        const response = await apiRequest('/api/rotation/strategy', {
+            method: 'PUT',
+            body: JSON.stringify({ strategy })
+        });
+
+        if (response.ok) {
+            renderStrategy(await response.json());
+            showToast('轮询策略已更新', 'success');
+        } else {
+            const error = await response.json();
+            showToast(errorMessage(error) || '更新失败', 'error');
+            loadStrategy();
+        }
+    } catch (error) {
+        showToast('网络错误', 'error');
+    }
+}
+
+// ========== Cookie 池 ==========
+
+// 加载 Cookie 池列表
+async function loadPools() {
+    try {
+        const response = await apiRequest('/api/pools');
+        if (response.ok) {
+            renderPoolTable(await response.json());
+        }
+    } catch (error) {
+        console.error('加载 Cookie 池失败:', error);
+    }
+}
+
+// 渲染 Cookie 池表格
+function renderPoolTable(pools) {
+    const tbody = document.getElementById('poolTableBody');
+    tbody.innerHTML = pools.map(pool => `
+        <tr>
+            <td>${escapeHtml(pool.name)}</td>
+            <td>${pool.cookie_count}</td>
+            <td>${pool.valid_count}</td>
+            <td>
+                <input type="checkbox" ${pool.shared ? 'checked' : ''} ${isAdmin ? '' : 'disabled'}
+                    onchange="setPoolShared('${encodeURIComponent(pool.name)}', this.checked)">
+            </td>
+        </tr>
+    `).join('');
+}
+
+// 设置 Cookie 池是否共享
+async function setPoolShared(name, shared) {
+    try {
+        const response = await apiRequest(`/api/pools/${name}`, {
+            method: 'PUT',
+            body: JSON.stringify({ shared })
+        });
+
+        if (response.ok) {
+            showToast(shared ? 'Cookie 池已共享' : 'Cookie 池已取消共享', 'success');
+        } else {
+            const error = await response.json();
+            showToast(errorMessage(error) || '更新失败', 'error');
+        }
+        loadPools();
+    } catch (error) {
+        showToast('网络错误', 'error');
+    }
 }
 
 // ========== Cookie 操作 ==========
@@ -303,7 +478,9 @@ document.getElementById('addCookieForm')?.addEventListener('submit', async (e) =
         name: formData.get('name'),
         api_key: formData.get('api_key'),
         session_key: formData.get('session_key') || '',
-        priority: parseInt(formData.get('priority') || '0')
+        priority: parseInt(formData.get('priority') || '0'),
+        pool: formData.get('pool') || '',
+        ...limitFields(formData)
     };
     
     try {
@@ -318,13 +495,22 @@ document.getElementById('addCookieForm')?.addEventListener('submit', async (e) =
             refreshCookies();
         } else {
             const error = await response.json();
-            showToast(error.error || '添加失败', 'error');
+            showToast(errorMessage(error) || '添加失败', 'error');
         }
     } catch (error) {
         showToast('网络错误', 'error');
     }
 });
 
+// 从表单读取限流设置，留空表示不限制
+function limitFields(formData) {
+    return {
+        rpm_limit: parseInt(formData.get('rpm_limit') || '0'),
+        daily_token_limit: parseInt(formData.get('daily_token_limit') || '0'),
+        max_concurrent: parseInt(formData.get('max_concurrent') || '0')
+    };
+}
+
 // 显示编辑弹窗
 async function editCookie(id) {
     try {
@@ -333,9 +519,18 @@ async function editCookie(id) {
             const cookie = await response.json();
             document.getElementById('editCookieId').value = cookie.id;
             document.getElementById('editCookieName').value = cookie.name;
-            document.getElementById('editApiKey').value = cookie.api_key || '';
-            document.getElementById('editSessionKey').value = cookie.session_key || '';
+            // 密钥只返回掩码，留空表示不修改
+            document.getElementById('editApiKey').value = '';
+            document.getElementById('editApiKey').placeholder = `${cookie.api_key}（留空则不修改）`;
+            document.getElementById('editSessionKey').value = '';
+            document.getElementById('editSessionKey').placeholder = cookie.session_key
+                ? `${cookie.session_key}（留空则不修改）`
+                : '输入 Session Key...';
             document.getElementById('editCookiePriority').value = cookie.priority || 0;
+            document.getElementById('editCookiePool').value = cookie.pool || 'default';
+            document.getElementById('editCookieRPMLimit').value = cookie.rpm_limit || '';
+            document.getElementById('editCookieDailyTokenLimit').value = cookie.daily_token_limit || '';
+            document.getElementById('editCookieMaxConcurrent').value = cookie.max_concurrent || '';
             document.getElementById('editModal').style.display = 'flex';
         }
     } catch (error) {
@@ -358,7 +553,9 @@ document.getElementById('editCookieForm')?.addEventListener('submit', async (e)
         name: formData.get('name'),
         api_key: formData.get('api_key'),
         session_key: formData.get('session_key') || '',
-        priority: parseInt(formData.get('priority') || '0')
+        priority: parseInt(formData.get('priority') || '0'),
+        pool: formData.get('pool') || '',
+        ...limitFields(formData)
     };
     
     try {
@@ -373,7 +570,7 @@ document.getElementById('editCookieForm')?.addEventListener('submit', async (e)
             refreshCookies();
         } else {
             const error = await response.json();
-            showToast(error.error || '更新失败', 'error');
+            showToast(errorMessage(error) || '更新失败', 'error');
         }
     } catch (error) {
         showToast('网络错误', 'error');
@@ -396,7 +593,7 @@ async function deleteCookie(id) {
             refreshCookies();
         } else {
             const error = await response.json();
-            showToast(error.error || '删除失败', 'error');
+            showToast(errorMessage(error) || '删除失败', 'error');
         }
     } catch (error) {
         showToast('网络错误', 'error');
@@ -417,7 +614,7 @@ async function validateCookie(id) {
             refreshCookies();
         } else {
             const error = await response.json();
-            showToast(error.error || '验证失败', 'error');
+            showToast(errorMessage(error) || '验证失败', 'error');
         }
     } catch (error) {
         showToast('网络错误', 'error');
@@ -431,18 +628,306 @@ async function validateAll() {
     }
     
     try {
-        showToast('正在批量验证...', 'success');
         const response = await apiRequest('/api/cookies/validate/all', {
             method: 'POST'
         });
         
         if (response.ok) {
-            const result = await response.json();
-            showToast(`验证完成：${result.valid_count} 个有效，${result.invalid_count} 个无效`, 'success');
+            const job = await response.json();
+            showValidationJob(job.total);
+            await followValidationJob(job.job_id);
+        } else {
+            const error = await response.json();
+            showToast(errorMessage(error) || '验证失败', 'error');
+        }
+    } catch (error) {
+        showToast('网络错误', 'error');
+    }
+}
+
+// 显示导入弹窗
+function showImportModal() {
+    document.getElementById('importForm').reset();
+    document.getElementById('importReport').style.display = 'none';
+    document.getElementById('importModal').style.display = 'flex';
+}
+
+// 关闭导入弹窗
+function closeImportModal() {
+    document.getElementById('importModal').style.display = 'none';
+}
+
+// 导入 Cookie
+document.getElementById('importForm')?.addEventListener('submit', async (e) => {
+    e.preventDefault();
+
+    const params = new URLSearchParams();
+    const format = document.getElementById('importFormat').value;
+    if (format) params.set('format', format);
+    params.set('pool', document.getElementById('importPool').value.trim());
+    if (document.getElementById('importValidate').checked) params.set('validate', 'true');
+
+    const submit = document.getElementById('importSubmit');
+    submit.disabled = true;
+    try {
+        const response = await apiRequest(`/api/cookies/import?${params}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'text/plain' },
+            body: document.getElementById('importData').value
+        });
+        const result = await response.json();
+
+        if (response.ok) {
+            renderImportReport(result);
             refreshCookies();
+        } else {
+            showToast(errorMessage(result) || '导入失败', 'error');
+        }
+    } catch (error) {
+        showToast('网络错误', 'error');
+    } finally {
+        submit.disabled = false;
+    }
+});
+
+// 显示导入结果
+function renderImportReport(result) {
+    const summary = result.summary;
+    const problems = result.results.filter(row => row.status !== 'created' || row.is_valid === false);
+    const statusText = { duplicate: '重复', invalid: '无效行', error: '失败', created: '验证未通过' };
+
+    const report = document.getElementById('importReport');
+    report.innerHTML = `
+        <div>新建 ${summary.created}，重复 ${summary.duplicate}，无效 ${summary.invalid}，失败 ${summary.error}</div>
+        ${problems.length > 0 ? `<ul>${problems.map(row => `
+            <li>第 ${row.row} 行 ${escapeHtml(row.name || '')}：${statusText[row.status]}${row.error ? ` - ${escapeHtml(row.error)}` : ''}</li>
+        `).join('')}</ul>` : ''}
+    `;
+    report.style.display = 'block';
+    showToast(`导入完成：新建 ${summary.created} 个`, 'success');
+}
+
+// 导出 Cookie
+async function exportCookies() {
+    const includeSecrets = confirm('是否在导出文件中包含 API Key 和 Session Key？\n点击“取消”只导出名称、池和优先级。');
+
+    try {
+        const response = await apiRequest(`/api/cookies/export?include_secrets=${includeSecrets}`);
+        if (!response.ok) {
+            const error = await response.json();
+            showToast(errorMessage(error) || '导出失败', 'error');
+            return;
+        }
+
+        const blob = await response.blob();
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = `cookies-${new Date().toISOString().slice(0, 10)}.json`;
+        link.click();
+        URL.revokeObjectURL(url);
+    } catch (error) {
+        showToast('网络错误', 'error');
+    }
+}
+
+// 显示批量验证进度面板
+function showValidationJob(total) {
+    document.getElementById('validationJob').style.display = 'block';
+    document.getElementById('validationJobBody').innerHTML = '';
+    updateValidationProgress(0, total);
+}
+
+// 更新进度条
+function updateValidationProgress(completed, total) {
+    document.getElementById('validationJobProgress').textContent = `${completed} / ${total}`;
+    const percent = total > 0 ? (completed / total) * 100 : 100;
+    document.getElementById('validationJobBar').style.width = `${percent}%`;
+}
+
+// 读取任务的 SSE 事件流（EventSource 不支持 Authorization 头，使用 fetch 读取）
+async function followValidationJob(jobId) {
+    const response = await apiRequest(`/api/jobs/${jobId}/events`);
+    if (!response || !response.ok) {
+        showToast('无法获取验证进度', 'error');
+        return;
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+
+    while (true) {
+        const { done, value } = await reader.read();
+        if (done) break;
+        buffer += decoder.decode(value, { stream: true });
+
+        let boundary;
+        while ((boundary = buffer.indexOf('\n\n')) !== -1) {
+            const frame = buffer.slice(0, boundary);
+            buffer = buffer.slice(boundary + 2);
+            handleValidationEvent(frame);
+        }
+    }
+}
+
+// 处理单个 SSE 事件
+function handleValidationEvent(frame) {
+    let type = '';
+    let data = '';
+    for (const line of frame.split('\n')) {
+        if (line.startsWith('event:')) type = line.slice(6).trim();
+        else if (line.startsWith('data:')) data += line.slice(5).trim();
+    }
+    if (!data) return;
+
+    const event = JSON.parse(data);
+    updateValidationProgress(event.completed, event.total);
+
+    if (type === 'result') {
+        appendValidationResult(event);
+    } else if (type === 'done') {
+        showToast(`验证完成：${event.valid_count} 个有效，${event.total - event.valid_count} 个无效`, 'success');
+        refreshCookies();
+    }
+}
+
+// 添加一行验证结果
+function appendValidationResult(event) {
+    let result = event.is_valid
+        ? '<span class="status-badge status-valid">✓ 有效</span>'
+        : '<span class="status-badge status-invalid">✗ 无效</span>';
+    if (event.transient) {
+        result = '<span class="status-badge status-cooling">? 未确定</span>';
+    }
+
+    const row = document.createElement('tr');
+    row.innerHTML = `
+        <td>${escapeHtml(event.name)}</td>
+        <td>${result}</td>
+        <td>${event.status_code || '-'}</td>
+        <td>${event.latency_ms ? `${event.latency_ms} ms` : '-'}</td>
+        <td><div class="cookie-error" title="${escapeHtml(event.error || '')}">${escapeHtml(event.error || '')}</div></td>
+    `;
+    document.getElementById('validationJobBody').appendChild(row);
+}
+
+// ========== API Key 操作 ==========
+
+// 加载 API Key 列表
+async function loadAPIKeys() {
+    try {
+        const response = await apiRequest('/api/keys');
+        if (response.ok) {
+            renderAPIKeyTable(await response.json());
+        }
+    } catch (error) {
+        console.error('加载 API Key 列表失败:', error);
+    }
+}
+
+// 渲染 API Key 表格
+function renderAPIKeyTable(keys) {
+    const tbody = document.getElementById('apiKeyTableBody');
+    const emptyState = document.getElementById('apiKeyEmptyState');
+
+    if (keys.length === 0) {
+        tbody.innerHTML = '';
+        emptyState.style.display = 'block';
+        return;
+    }
+
+    emptyState.style.display = 'none';
+
+    tbody.innerHTML = keys.map((key, index) => `
+        <tr>
+            <td>${index + 1}</td>
+            <td>${escapeHtml(key.name)}</td>
+            <td><code>${escapeHtml(key.key_prefix)}...</code></td>
+            <td>
+                <span class="status-badge ${key.revoked ? 'status-invalid' : 'status-valid'}">
+                    ${key.revoked ? '⛔ 已吊销' : '✅ 可用'}
+                </span>
+            </td>
+            <td>
+                ${key.own_cookies_only ? '仅自己的 Cookie' : '全部 Cookie'}
+                ${key.cookie_pool ? `<br><small>Cookie 池：${escapeHtml(key.cookie_pool)}</small>` : ''}
+                ${key.allow_cookie_override ? '<br><small>允许指定 Cookie</small>' : ''}
+            </td>
+            <td>${(key.usage_count || 0).toLocaleString()}</td>
+            <td>${formatTime(key.last_used)}</td>
+            <td>
+                <div class="action-buttons">
+                    ${key.revoked ? '' : `<button class="btn btn-danger btn-sm" onclick="revokeAPIKey(${key.id})">吊销</button>`}
+                </div>
+            </td>
+        </tr>
+    `).join('');
+}
+
+// 显示创建 API Key 弹窗
+function showAddKeyModal() {
+    document.getElementById('addKeyForm').reset();
+    document.getElementById('createdKeyGroup').style.display = 'none';
+    document.getElementById('addKeySubmit').style.display = '';
+    document.getElementById('addKeyModal').style.display = 'flex';
+}
+
+// 关闭创建 API Key 弹窗
+function closeAddKeyModal() {
+    document.getElementById('addKeyModal').style.display = 'none';
+}
+
+// 创建 API Key
+document.getElementById('addKeyForm')?.addEventListener('submit', async (e) => {
+    e.preventDefault();
+
+    const data = {
+        name: document.getElementById('keyName').value,
+        own_cookies_only: document.getElementById('keyOwnCookiesOnly').checked,
+        cookie_pool: document.getElementById('keyCookiePool').value.trim(),
+        allow_cookie_override: document.getElementById('keyAllowCookieOverride').checked
+    };
+
+    try {
+        const response = await apiRequest('/api/keys', {
+            method: 'POST',
+            body: JSON.stringify(data)
+        });
+
+        if (response.ok) {
+            const key = await response.json();
+            document.getElementById('createdKey').value = key.key;
+            document.getElementById('createdKeyGroup').style.display = 'block';
+            document.getElementById('addKeySubmit').style.display = 'none';
+            showToast('API Key 创建成功', 'success');
+            loadAPIKeys();
+        } else {
+            const error = await response.json();
+            showToast(errorMessage(error) || '创建失败', 'error');
+        }
+    } catch (error) {
+        showToast('网络错误', 'error');
+    }
+});
+
+// 吊销 API Key
+async function revokeAPIKey(id) {
+    if (!confirm('确定要吊销这个 API Key 吗？吊销后无法恢复。')) {
+        return;
+    }
+
+    try {
+        const response = await apiRequest(`/api/keys/${id}`, {
+            method: 'DELETE'
+        });
+
+        if (response.ok) {
+            showToast('API Key 已吊销', 'success');
+            loadAPIKeys();
         } else {
             const error = await response.json();
-            showToast(error.error || '验证失败', 'error');
+            showToast(errorMessage(error) || '吊销失败', 'error');
         }
     } catch (error) {
         showToast('网络错误', 'error');